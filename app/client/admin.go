@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// requireAdmin : the /admin pages are only for the users of [auth] admins (by id)
+func requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s := currentSession(c)
+		if s == nil {
+			return c.String(http.StatusForbidden, "Forbidden: only the users of [auth] admins can open this page")
+		}
+		if !store.Get().IsAdmin(s.UserID) {
+			return c.String(http.StatusForbidden, fmt.Sprintf("Forbidden: only the users of [auth] admins can open this page (your user id: %v)", s.UserID))
+		}
+		return next(c)
+	}
+}
+
+// adminConfig : effective settings of the web client (credentials are redacted)
+func adminConfig(c echo.Context) error {
+	data := struct {
+		Path     string
+		Settings interface{}
+	}{
+		Path:     store.Path(),
+		Settings: store.Get().Settings(),
+	}
+	return c.Render(http.StatusOK, "config.html", data)
+}
+
+// cacheData : entries of the scrape cache & the one inspected with ?url=
+type cacheData struct {
+	Enabled    bool
+	Dir        string
+	TTL        time.Duration
+	MaxEntries int
+	Entries    []cacheEntry
+	Inspected  *goscraper.CachedPreview
+	Message    string
+}
+
+type cacheEntry struct {
+	*goscraper.CachedPreview
+	Fresh bool // reused without request
+}
+
+// adminCache : the cached previews (GET /admin/cache?url=... shows the preview of url)
+func adminCache(c echo.Context) error {
+	conf := store.Get()
+	data := cacheData{Dir: conf.ScraperCacheDir, TTL: conf.ScraperCacheTTL, MaxEntries: conf.ScraperCacheMaxEntries, Message: c.QueryParam("message")}
+	cache := conf.ScrapeCache()
+	if cache == nil {
+		return c.Render(http.StatusOK, "cache.html", data)
+	}
+	data.Enabled = true
+	for _, e := range cache.Entries() {
+		data.Entries = append(data.Entries, cacheEntry{CachedPreview: e, Fresh: time.Since(e.StoredAt) < conf.ScraperCacheTTL})
+	}
+	if raw := c.QueryParam("url"); raw != "" {
+		u, err := url.Parse(raw)
+		if err == nil {
+			key := goscraper.NormalizeURL(u)
+			for _, e := range data.Entries {
+				if e.Key == key {
+					data.Inspected = e.CachedPreview
+				}
+			}
+		}
+		if data.Inspected == nil {
+			data.Message = "Not cached: " + raw
+		}
+	}
+	return c.Render(http.StatusOK, "cache.html", data)
+}
+
+// adminPurgeCache : the cached preview of the posted "url" is removed (every preview if blank)
+func adminPurgeCache(c echo.Context) error {
+	cache := store.Get().ScrapeCache()
+	if cache == nil {
+		return c.Redirect(http.StatusFound, "/admin/cache")
+	}
+	message := ""
+	if raw := c.FormValue("url"); raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil || !cache.Delete(goscraper.NormalizeURL(u)) {
+			message = "Not cached: " + raw
+		} else {
+			message = "Purged: " + raw
+		}
+	} else {
+		message = fmt.Sprintf("Purged %v previews", cache.Purge())
+	}
+	return c.Redirect(http.StatusFound, "/admin/cache?message="+url.QueryEscape(message))
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"myTips/tipstocks/app/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+// TestRequireAdmin : the /admin pages are only for the users of [auth] admins, by id
+func TestRequireAdmin(t *testing.T) {
+	store = utils.NewStore(utils.Configs{AuthAdmins: []string{"64b7f0c2a1e4d3b2c1a09f8e"}})
+	handler := requireAdmin(func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	cases := []struct {
+		session *session
+		want    int
+	}{
+		{nil, http.StatusForbidden},
+		{&session{UserID: "64b7f0c2a1e4d3b2c1a09f8f", Username: "alice"}, http.StatusForbidden},
+		{&session{UserID: "64b7f0c2a1e4d3b2c1a09f8f", Username: "64b7f0c2a1e4d3b2c1a09f8e"}, http.StatusForbidden}, // a username claiming the id
+		{&session{UserID: "64b7f0c2a1e4d3b2c1a09f8e", Username: "root"}, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(httptest.NewRequest("GET", "/admin/config", nil), rec)
+		if c.session != nil {
+			ctx.Set(sessionUser, c.session)
+		}
+		if err := handler(ctx); err != nil || rec.Code != c.want {
+			t.Errorf("%+v: %v %v (want %v)", c.session, rec.Code, err, c.want)
+		}
+	}
+}
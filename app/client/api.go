@@ -0,0 +1,471 @@
+package main
+
+import (
+	"io"
+	"log"
+	"myTips/tipstocks/app/protobuf"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ----- JSON API (/api/v1) ----- //
+const apiPrefix = "/api/v1"
+
+// apiTip : JSON representation of a tip
+type apiTip struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	Image       string    `json:"image"`
+	Pages       int32     `json:"pages,omitempty"`
+	Embed       *apiEmbed `json:"embed,omitempty"`
+	OwnerID     string    `json:"owner_id"`
+	WorkspaceID string    `json:"workspace_id"`
+}
+
+// apiEmbed : oEmbed of a tip (html as returned by the provider)
+type apiEmbed struct {
+	Type         string `json:"type"`
+	Title        string `json:"title,omitempty"`
+	AuthorName   string `json:"author_name,omitempty"`
+	AuthorURL    string `json:"author_url,omitempty"`
+	ProviderName string `json:"provider_name,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	HTML         string `json:"html,omitempty"`
+	Width        int32  `json:"width,omitempty"`
+	Height       int32  `json:"height,omitempty"`
+}
+
+// apiTipList : a page of tips
+type apiTipList struct {
+	Tips    []apiTip `json:"tips"`
+	Page    int      `json:"page"`
+	PerPage int      `json:"per_page"`
+}
+
+// apiNewTip : request body for creating a tip from its url
+type apiNewTip struct {
+	URL string `json:"url"`
+}
+
+// apiError : error body, "status" is the name of the gRPC status code
+type apiError struct {
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// apiParam : a path or query parameter of a route
+type apiParam struct {
+	Name        string
+	In          string // "path" or "query"
+	Type        string // "string" or "integer"
+	Description string
+}
+
+// apiRoute : a route of the JSON API, also used for generating the OpenAPI document
+type apiRoute struct {
+	Method      string
+	Path        string // echo style path (e.g. /tips/:id)
+	OperationID string
+	Summary     string
+	Params      []apiParam
+	Body        string // schema name of the request body ("" if no body)
+	Response    string // schema name of the response body ("" if no content)
+	Status      int    // status code on success
+	Handler     func(c echo.Context, pc protobuf.TipServiceClient) error
+}
+
+var apiRoutes = []apiRoute{
+	{
+		Method:      http.MethodGet,
+		Path:        "/tips",
+		OperationID: "listTips",
+		Summary:     "List tips page by page",
+		Params: []apiParam{
+			{Name: "page", In: "query", Type: "integer", Description: "page number starting from 1 (default: 1)"},
+			{Name: "per_page", In: "query", Type: "integer", Description: "tips per page, up to 100 (default: 20)"},
+		},
+		Response: "TipList",
+		Status:   http.StatusOK,
+		Handler:  apiListTips,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/tips",
+		OperationID: "createTip",
+		Summary:     "Create a tip from the preview of a url",
+		Body:        "NewTip",
+		Response:    "Tip",
+		Status:      http.StatusCreated,
+		Handler:     apiCreateTip,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/tips/search",
+		OperationID: "searchTips",
+		Summary:     "Search tips by title",
+		Params: []apiParam{
+			{Name: "title", In: "query", Type: "string", Description: "keywords of the title (case-insensitive)"},
+		},
+		Response: "TipList",
+		Status:   http.StatusOK,
+		Handler:  apiSearchTips,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/tips/:id",
+		OperationID: "getTip",
+		Summary:     "Get a tip",
+		Params:      []apiParam{{Name: "id", In: "path", Type: "string", Description: "tip id"}},
+		Response:    "Tip",
+		Status:      http.StatusOK,
+		Handler:     apiGetTip,
+	},
+	{
+		Method:      http.MethodPatch,
+		Path:        "/tips/:id",
+		OperationID: "updateTip",
+		Summary:     "Update a tip (blank fields are kept as they are)",
+		Params:      []apiParam{{Name: "id", In: "path", Type: "string", Description: "tip id"}},
+		Body:        "Tip",
+		Response:    "Tip",
+		Status:      http.StatusOK,
+		Handler:     apiUpdateTip,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/tips/:id",
+		OperationID: "deleteTip",
+		Summary:     "Delete a tip",
+		Params:      []apiParam{{Name: "id", In: "path", Type: "string", Description: "tip id"}},
+		Status:      http.StatusNoContent,
+		Handler:     apiDeleteTip,
+	},
+}
+
+func registerAPI(e *echo.Echo, pc protobuf.TipServiceClient) {
+	for _, r := range apiRoutes {
+		e.Add(r.Method, apiPrefix+r.Path, makeHandler(r.Handler, pc))
+	}
+	doc := openAPIDocument(apiRoutes)
+	e.GET(apiPrefix+"/openapi.json", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, doc)
+	})
+}
+
+func apiListTips(c echo.Context, pc protobuf.TipServiceClient) error {
+	page, err := intQueryParam(c, "page", 1)
+	if err != nil || page < 1 {
+		return apiErrorJSON(c, status.Errorf(codes.InvalidArgument, "invalid page: %v", c.QueryParam("page")))
+	}
+	perPage, err := intQueryParam(c, "per_page", 20)
+	if err != nil || perPage < 1 || perPage > 100 {
+		return apiErrorJSON(c, status.Errorf(codes.InvalidArgument, "invalid per_page: %v", c.QueryParam("per_page")))
+	}
+	req := &protobuf.AllTipsRequest{
+		Offset: int64((page - 1) * perPage),
+		Limit:  int64(perPage),
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	stream, err := pc.AllTips(ctx, req)
+	if err != nil {
+		return apiErrorJSON(c, err)
+	}
+	tips := make([]*protobuf.Tip, 0)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return apiErrorJSON(c, err)
+		}
+		tips = append(tips, res.GetTip())
+	}
+	return c.JSON(http.StatusOK, apiTipList{Tips: toAPITips(tips), Page: page, PerPage: perPage})
+}
+
+func apiCreateTip(c echo.Context, pc protobuf.TipServiceClient) error {
+	body := &apiNewTip{}
+	if err := c.Bind(body); err != nil || body.URL == "" {
+		return apiErrorJSON(c, status.Error(codes.InvalidArgument, "request body must contain a url"))
+	}
+	tip, err := createTip(c.Request().Context(), pc, body.URL, "")
+	if err != nil {
+		if _, ok := status.FromError(err); !ok { // the url cannot be previewed
+			err = status.Error(codes.InvalidArgument, err.Error())
+		}
+		return apiErrorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, toAPITip(tip))
+}
+
+func apiSearchTips(c echo.Context, pc protobuf.TipServiceClient) error {
+	tips, err := searchTips(pc, c.QueryParam("title"))
+	if err != nil {
+		return apiErrorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, apiTipList{Tips: toAPITips(tips), Page: 1, PerPage: len(tips)})
+}
+
+func apiGetTip(c echo.Context, pc protobuf.TipServiceClient) error {
+	tip, err := getTip(pc, c.Param("id"))
+	if err != nil {
+		return apiErrorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, toAPITip(tip))
+}
+
+func apiUpdateTip(c echo.Context, pc protobuf.TipServiceClient) error {
+	body := &apiTip{}
+	if err := c.Bind(body); err != nil {
+		return apiErrorJSON(c, status.Errorf(codes.InvalidArgument, "invalid request body: %v", err))
+	}
+	tip, err := updateTip(pc, &protobuf.Tip{
+		Id:          c.Param("id"), // id in the body is ignored
+		Title:       body.Title,
+		Url:         body.URL,
+		Description: body.Description,
+		Image:       body.Image,
+	})
+	if err != nil {
+		return apiErrorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, toAPITip(tip))
+}
+
+func apiDeleteTip(c echo.Context, pc protobuf.TipServiceClient) error {
+	if err := deleteTip(pc, c.Param("id")); err != nil {
+		return apiErrorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func toAPITip(tip *protobuf.Tip) apiTip {
+	res := apiTip{
+		ID:          tip.GetId(),
+		Title:       tip.GetTitle(),
+		URL:         tip.GetUrl(),
+		Description: tip.GetDescription(),
+		Image:       tip.GetImage(),
+		Pages:       tip.GetPages(),
+		OwnerID:     tip.GetOwnerId(),
+		WorkspaceID: tip.GetWorkspaceId(),
+	}
+	if embed := tip.GetEmbed(); embed != nil {
+		res.Embed = &apiEmbed{
+			Type:         embed.GetType(),
+			Title:        embed.GetTitle(),
+			AuthorName:   embed.GetAuthorName(),
+			AuthorURL:    embed.GetAuthorUrl(),
+			ProviderName: embed.GetProviderName(),
+			ThumbnailURL: embed.GetThumbnailUrl(),
+			HTML:         embed.GetHtml(),
+			Width:        embed.GetWidth(),
+			Height:       embed.GetHeight(),
+		}
+	}
+	return res
+}
+
+func toAPITips(tips []*protobuf.Tip) []apiTip {
+	res := make([]apiTip, 0, len(tips))
+	for _, tip := range tips {
+		res = append(res, toAPITip(tip))
+	}
+	return res
+}
+
+func intQueryParam(c echo.Context, name string, defaultValue int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(v)
+}
+
+// apiErrorJSON : render an error as JSON with the HTTP status code of its gRPC status code
+func apiErrorJSON(c echo.Context, err error) error {
+	st := status.Convert(err) // non-status errors become codes.Unknown
+	code := httpStatusFromCode(st.Code())
+	if code == http.StatusInternalServerError {
+		log.Println("API error: ", err)
+	}
+	return c.JSON(code, apiError{
+		Code:    code,
+		Status:  st.Code().String(),
+		Message: st.Message(),
+	})
+}
+
+// httpStatusFromCode : gRPC status code -> HTTP status code
+// (same mapping as https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto)
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client Closed Request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default: // codes.Unknown, codes.Internal, codes.DataLoss
+		return http.StatusInternalServerError
+	}
+}
+
+// ----- OpenAPI document ----- //
+var apiSchemas = map[string]interface{}{
+	"Tip": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":           map[string]string{"type": "string"},
+			"title":        map[string]string{"type": "string"},
+			"url":          map[string]string{"type": "string"},
+			"description":  map[string]string{"type": "string"},
+			"image":        map[string]string{"type": "string"},
+			"pages":        map[string]string{"type": "integer"},
+			"embed":        schemaRef("Embed"),
+			"owner_id":     map[string]string{"type": "string"},
+			"workspace_id": map[string]string{"type": "string"},
+		},
+	},
+	"Embed": map[string]interface{}{
+		"type":        "object",
+		"description": "oEmbed of video & social links (html is not sanitized)",
+		"properties": map[string]interface{}{
+			"type":          map[string]string{"type": "string"},
+			"title":         map[string]string{"type": "string"},
+			"author_name":   map[string]string{"type": "string"},
+			"author_url":    map[string]string{"type": "string"},
+			"provider_name": map[string]string{"type": "string"},
+			"thumbnail_url": map[string]string{"type": "string"},
+			"html":          map[string]string{"type": "string"},
+			"width":         map[string]string{"type": "integer"},
+			"height":        map[string]string{"type": "integer"},
+		},
+	},
+	"TipList": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tips":     map[string]interface{}{"type": "array", "items": schemaRef("Tip")},
+			"page":     map[string]string{"type": "integer"},
+			"per_page": map[string]string{"type": "integer"},
+		},
+	},
+	"NewTip": map[string]interface{}{
+		"type":     "object",
+		"required": []string{"url"},
+		"properties": map[string]interface{}{
+			"url": map[string]string{"type": "string"},
+		},
+	},
+	"Error": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"code":    map[string]string{"type": "integer"},
+			"status":  map[string]string{"type": "string"},
+			"message": map[string]string{"type": "string"},
+		},
+	},
+}
+
+// openAPIDocument : generate an OpenAPI 3.0 document from the routes
+func openAPIDocument(routes []apiRoute) map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, r := range routes {
+		path := openAPIPath(r.Path)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		params := make([]interface{}, 0, len(r.Params))
+		for _, p := range r.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.In == "path",
+				"description": p.Description,
+				"schema":      map[string]string{"type": p.Type},
+			})
+		}
+		success := map[string]interface{}{"description": http.StatusText(r.Status)}
+		if r.Response != "" {
+			success["content"] = jsonContent(r.Response)
+		}
+		op := map[string]interface{}{
+			"operationId": r.OperationID,
+			"summary":     r.Summary,
+			"parameters":  params,
+			"responses": map[string]interface{}{
+				strconv.Itoa(r.Status): success,
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent("Error"),
+				},
+			},
+		}
+		if r.Body != "" {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(r.Body),
+			}
+		}
+		item[strings.ToLower(r.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "tipstocks API",
+			"version": "v1",
+		},
+		"servers":    []interface{}{map[string]string{"url": apiPrefix}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": apiSchemas},
+	}
+}
+
+// openAPIPath : echo style path -> OpenAPI style path (e.g. /tips/:id -> /tips/{id})
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func jsonContent(schema string) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": schemaRef(schema)},
+	}
+}
+
+func schemaRef(schema string) map[string]string {
+	return map[string]string{"$ref": "#/components/schemas/" + schema}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"html/template"
 	"io"
@@ -12,12 +14,14 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/labstack/echo"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 )
 
@@ -32,15 +36,16 @@ func (t *tpl) Render(w io.Writer, name string, data interface{}, c echo.Context)
 
 func makeHandler(handler func(c echo.Context, pc protobuf.TipServiceClient) error, pc protobuf.TipServiceClient) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		render := handler(c, pc)
+		render := handler(c, asUser(pc, c)) // on behalf of the user signed in
 		return render
 	}
 }
 
 func index(c echo.Context, pc protobuf.TipServiceClient) error {
 	tips, err := allTips(pc)
-	if err != nil {
-		log.Fatalln(err)
+	if err != nil { // e.g. removed from the workspace
+		log.Println(err)
+		tips = []*protobuf.Tip{}
 	}
 	return c.Render(http.StatusOK, "index.html", tips)
 }
@@ -70,31 +75,77 @@ func blankSearchResult(c echo.Context, pc protobuf.TipServiceClient) error {
 	return c.Render(http.StatusOK, "result.html", foundTips)
 }
 
+// registerData : the url to register & the preview whose image is picked before registering
+type registerData struct {
+	Error   string
+	URL     string
+	Preview *goscraper.DocumentPreview
+}
+
 func register(c echo.Context) error {
-	err := ""
-	return c.Render(http.StatusOK, "register.html", err)
+	return c.Render(http.StatusOK, "register.html", registerData{})
 }
 
+// registerNewTip : the tip is registered at once if the page has one image candidate at most,
+// otherwise the candidates are shown to pick one ("confirm" is then posted with the "image")
 func registerNewTip(c echo.Context, pc protobuf.TipServiceClient) error {
 	url := c.FormValue("url")
-	_, err := createTip(pc, url)
+	var err error
+	if c.FormValue("confirm") != "" {
+		_, err = createTip(c.Request().Context(), pc, url, c.FormValue("image"))
+	} else {
+		var s *goscraper.Document
+		s, err = scrapeUrl(c.Request().Context(), url)
+		if err == nil && len(s.Preview.Images) > 1 {
+			return c.Render(http.StatusOK, "register.html", registerData{URL: url, Preview: &s.Preview})
+		}
+		if err == nil {
+			_, err = saveTip(pc, url, s, "")
+		}
+	}
 	if err != nil {
 		log.Println(err)
-		return c.Render(http.StatusOK, "register.html", fmt.Sprintln(err))
+		return c.Render(http.StatusOK, "register.html", registerData{Error: fmt.Sprintln(err), URL: url})
 	}
 	return c.Redirect(http.StatusFound, "/")
 }
 
+// tipData : a tip & its oEmbed HTML once sanitized
+type tipData struct {
+	Tip   *protobuf.Tip
+	Embed template.HTML
+}
+
+func detail(c echo.Context, pc protobuf.TipServiceClient) error {
+	tip, err := getTip(pc, c.Param("id"))
+	if err != nil {
+		log.Println(err)
+		return c.Redirect(http.StatusFound, "/")
+	}
+	data := tipData{Tip: tip}
+	if embed := tip.GetEmbed(); embed != nil {
+		data.Embed = template.HTML(goscraper.SanitizeEmbed(embed.GetHtml(), c.Request().Host)) // scripts & handlers are removed
+	}
+	return c.Render(http.StatusOK, "tip.html", data)
+}
+
+// deleteData : data of delete.html
+type deleteData struct {
+	Tips []*protobuf.Tip
+	CSRF string // token of the session, posted with the forms
+}
+
 func delete(c echo.Context, pc protobuf.TipServiceClient) error {
 	tips, err := allTips(pc)
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		tips = []*protobuf.Tip{}
 	}
-	return c.Render(http.StatusOK, "delete.html", tips)
+	return c.Render(http.StatusOK, "delete.html", deleteData{Tips: tips, CSRF: csrfToken(currentSession(c))})
 }
 
 func remove(c echo.Context, pc protobuf.TipServiceClient) error {
-	id := c.QueryParam("id")
+	id := c.FormValue("id")
 	err := deleteTip(pc, id)
 	if err != nil {
 		log.Println(err)
@@ -104,30 +155,64 @@ func remove(c echo.Context, pc protobuf.TipServiceClient) error {
 }
 
 // ----- gRPC server functions ----- //
-func createTip(c protobuf.TipServiceClient, url string) (*protobuf.Tip, error) {
-	r, err := http.Get(url)
+// createTip : tip of the preview of url with image if it is one of the candidates (the best one otherwise)
+func createTip(ctx context.Context, c protobuf.TipServiceClient, url string, image string) (*protobuf.Tip, error) {
+	s, err := scrapeUrl(ctx, url)
 	if err != nil {
 		return nil, err
 	}
-	if r.StatusCode != 200 {
-		return nil, &urlNotFound{url}
-	}
+	return saveTip(c, url, s, image)
+}
 
-	s, err := goscraper.Scrape(url, 5)
+// scrapeUrl : preview of url, given up when ctx is done (e.g. the request is canceled) or after [scraper] timeout
+func scrapeUrl(ctx context.Context, url string) (*goscraper.Document, error) {
+	s, err := goscraper.ScrapeContext(ctx, url, store.Get().ScraperOptions())
 	if err != nil {
 		log.Println("Cannot get a preview of a webpage: ", err)
+		var blocked *goscraper.BlockedError
+		if errors.As(err, &blocked) { // e.g. a private address or a redirect to one
+			return nil, status.Errorf(codes.InvalidArgument, "%v", blocked)
+		}
 		return nil, err
 	}
+	if s.StatusCode != http.StatusOK {
+		return nil, &urlNotFound{url}
+	}
+	return s, nil
+}
+
+func saveTip(c protobuf.TipServiceClient, url string, s *goscraper.Document, image string) (*protobuf.Tip, error) {
 	tip := &protobuf.Tip{
 		Title:       s.Preview.Title,
 		Url:         url,
 		Description: s.Preview.Description,
-		Image:       s.Preview.Images[0],
+		Pages:       int32(s.Preview.Pages),
+	}
+	if len(s.Preview.Images) > 0 { // e.g. PDF documents have no image
+		tip.Image = s.Preview.Images[0]
+	}
+	for _, img := range s.Preview.Images {
+		if img == image {
+			tip.Image = image
+		}
+	}
+	if o := s.Preview.OEmbed; o != nil {
+		tip.Embed = &protobuf.Embed{
+			Type:         o.Type,
+			Title:        o.Title,
+			AuthorName:   o.AuthorName,
+			AuthorUrl:    o.AuthorURL,
+			ProviderName: o.ProviderName,
+			ThumbnailUrl: o.ThumbnailURL,
+			Html:         o.HTML,
+			Width:        int32(o.Width),
+			Height:       int32(o.Height),
+		}
 	}
 	req := &protobuf.CreateTipRequest{
 		Tip: tip,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := requestContext()
 	defer cancel()
 	res, err := c.CreateTip(ctx, req)
 	if err != nil {
@@ -150,7 +235,7 @@ func deleteTip(c protobuf.TipServiceClient, id string) error {
 	req := &protobuf.DeleteTipRequest{
 		TipId: id,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := requestContext()
 	defer cancel()
 	res, err := c.DeleteTip(ctx, req)
 	if err != nil {
@@ -175,9 +260,38 @@ func deleteTip(c protobuf.TipServiceClient, id string) error {
 	return nil
 }
 
+func getTip(c protobuf.TipServiceClient, id string) (*protobuf.Tip, error) {
+	req := &protobuf.GetTipRequest{
+		TipId: id,
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	res, err := c.GetTip(ctx, req)
+	if err != nil {
+		log.Println("error while calling GetTip: ", err)
+		return nil, err
+	}
+	return res.GetTip(), nil
+}
+
+func updateTip(c protobuf.TipServiceClient, tip *protobuf.Tip) (*protobuf.Tip, error) {
+	req := &protobuf.UpdateTipRequest{
+		Tip: tip,
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	res, err := c.UpdateTip(ctx, req)
+	if err != nil {
+		log.Println("error while calling UpdateTip: ", err)
+		return nil, err
+	}
+	fmt.Println("Update a tip completed!: ", res.GetTip().GetId())
+	return res.GetTip(), nil
+}
+
 func allTips(c protobuf.TipServiceClient) ([]*protobuf.Tip, error) {
 	req := &protobuf.AllTipsRequest{}
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := requestContext()
 	defer cancel()
 	stream, err := c.AllTips(ctx, req)
 	if err != nil {
@@ -213,7 +327,7 @@ func searchTips(c protobuf.TipServiceClient, title string) ([]*protobuf.Tip, err
 	req := &protobuf.SearchTipsRequest{
 		TipTitle: title,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	ctx, cancel := requestContext()
 	defer cancel()
 	stream, err := c.SearchTips(ctx, req)
 	if err != nil {
@@ -244,23 +358,64 @@ func reverse(tips []*protobuf.Tip) []*protobuf.Tip {
 	return tips
 }
 
+// waitForServer : wait until the gRPC server reports SERVING, with exponential backoff
+func waitForServer(cc *grpc.ClientConn) {
+	hc := healthpb.NewHealthClient(cc)
+	backoff := 100 * time.Millisecond
+	const maxBackoff = 10 * time.Second
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		res, err := hc.Check(ctx, &healthpb.HealthCheckRequest{Service: protobuf.TipService_ServiceDesc.ServiceName})
+		cancel()
+		if err == nil && res.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+			fmt.Println("gRPC server is ready!")
+			return
+		}
+		log.Printf("gRPC server is not ready (retry in %v): %v %v\n", backoff, res.GetStatus(), err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// requestContext : context for a request to the gRPC server ([client] request_timeout)
+func requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), store.Get().ClientRequestTimeout)
+}
+
 // ----- client funcs ----- //
+var store *utils.Store // hot-reloadable settings
+
 func main() {
 	// Getting the file name & line number if we crashed the go codes
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	conf := utils.LoadConf("app/utils/config.ini")
+	flag.Parse()
+
+	conf, confErr := utils.Setup() // defaults < config.ini < $TIPSTOCKS_* < --set flags
+	if confErr != nil {
+		log.Fatalf("invalid configuration:\n\t%v", confErr)
+	}
+	store = utils.NewStore(conf)
+	utils.SetLogLevel(conf.LogLevel)
+	limiter := newRateLimiter()
+	limiter.apply(conf)
 	opts := grpc.WithInsecure()
-	if !conf.ServerDebug {
-		certFile := "app/ssl/ca.crt"
-		creds, sslErr := credentials.NewClientTLSFromFile(certFile, "")
+	if conf.TLSEnabled { // [tls] section (client certificate with client_auth = true)
+		tlsConf, sslErr := conf.ClientTLSConfig()
 		if sslErr != nil {
-			log.Fatalf("Error while loading CA trust certificate: %v", sslErr)
+			log.Fatalf("Error while loading certificates: %v", sslErr)
 		}
-		opts = grpc.WithTransportCredentials(creds)
+		opts = grpc.WithTransportCredentials(credentials.NewTLS(tlsConf))
+	}
+	dialOpts := []grpc.DialOption{opts}
+	if conf.AuthEnabled { // the web client calls TipService with its service token
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(utils.BearerToken(conf.AuthServiceToken, conf.TLSEnabled)))
 	}
 	target := fmt.Sprintf("server:%v", conf.ServerPort)
-	cc, err := grpc.Dial(target, opts)
+	cc, err := grpc.Dial(target, dialOpts...)
 	if err != nil {
 		fmt.Println("could not connect: ", err)
 	}
@@ -268,14 +423,27 @@ func main() {
 	// defer fmt.Println("\nClient stopped.")
 	defer cc.Close()
 	c := protobuf.NewTipServiceClient(cc)
+	uc := protobuf.NewUserServiceClient(cc)
+	wc := protobuf.NewWorkspaceServiceClient(cc)
+	setupSessionKey(conf)
 
 	e := echo.New()
+	e.Debug = conf.ClientDebug
 	t := &tpl{
 		templates: template.Must(template.ParseGlob("app/client/src/views/*.html")),
 	}
 	e.Renderer = t
+	e.Use(limiter.middleware)
+	e.Use(requireLogin) // except the pages to sign in
 	e.Static("/css", "app/client/src/css")
 	e.Static("/img", "app/client/src/img")
+	e.GET("/login", loginPage)
+	e.POST("/login", makeUserHandler(login, uc))
+	e.GET("/login/oidc", oidcLogin)
+	e.GET("/login/oidc/callback", makeUserHandler(oidcCallback, uc))
+	e.GET("/signup", signupPage)
+	e.POST("/signup", makeUserHandler(signup, uc))
+	e.POST("/logout", logout)
 	e.GET("/", makeHandler(index, c))
 	e.GET("/search", search)
 	e.GET("/search/", search)
@@ -283,25 +451,56 @@ func main() {
 	e.POST("/search/result", makeHandler(searchResult, c))
 	e.GET("/register", register)
 	e.POST("/register", makeHandler(registerNewTip, c))
+	e.GET("/tips/:id", makeHandler(detail, c))
 	e.GET("/delete", makeHandler(delete, c))
-	e.GET("/remove", makeHandler(remove, c))
+	e.POST("/remove", makeHandler(remove, c), requireCSRF)
+	e.GET("/workspaces", makeWorkspaceHandler(workspacesPage, wc))
+	e.POST("/workspaces", makeWorkspaceHandler(createWorkspace, wc))
+	e.POST("/workspaces/switch", switchWorkspace)
+	e.POST("/workspaces/invite", makeWorkspaceHandler(inviteMember, wc))
+	e.POST("/workspaces/members/remove", makeWorkspaceHandler(removeMember, wc))
+	e.GET("/invite/:token", invitePage)
+	e.POST("/invite/:token", makeWorkspaceHandler(acceptInvite, wc))
+	registerAPI(e, c) // JSON API: /api/v1/...
+
+	// [auth] admins only
+	admin := e.Group("/admin", requireAdmin)
+	admin.GET("/config", adminConfig)
+	admin.GET("/cache", adminCache)
+	admin.POST("/cache/purge", adminPurgeCache)
+
+	// reload settings on SIGHUP & changes of config.ini
+	watchCtx, watchCancel := context.WithCancel(context.Background())
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		store.Watch(watchCtx, func(conf utils.Configs) {
+			utils.SetLogLevel(conf.LogLevel)
+			limiter.apply(conf)
+		})
+	}()
 
 	// running client as goroutine
 	go func() {
-		for {
-			req := &protobuf.AllTipsRequest{}
-			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-			defer cancel()
-			_, err := c.AllTips(ctx, req)
-			if err != nil {
-				continue
-			}
-			break
+		waitForServer(cc) // until the gRPC server (and MongoDB) gets ready
+		if err := e.Start(fmt.Sprintf("0.0.0.0:%v", conf.ClientPort)); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
 		}
-		e.Logger.Fatal(e.Start(fmt.Sprintf("0.0.0.0:%v", conf.ClientPort)))
 	}()
-	// wait for "Control + C" to exit
+	// wait for "Control + C" or SIGTERM (docker stop) to exit
 	interruptCh := make(chan os.Signal, 1)
-	signal.Notify(interruptCh, os.Interrupt)
-	<-interruptCh // block until receiving an interrupt signal
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-interruptCh // block until receiving a signal
+	conf = store.Get()
+	fmt.Printf("\n%v received: draining connections... (deadline: %v)\n", sig, conf.ClientDrainTimeout)
+
+	// graceful shutdown: finish in-flight requests before closing the gRPC connection
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ClientDrainTimeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Println("failed to drain connections: ", err)
+	}
+	watchCancel()
+	<-watchDone
+	utils.FlushScrapeCache()
 }
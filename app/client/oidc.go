@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils/sso"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	oidcCookie  = "tipstocks_oidc"
+	oidcFlowTTL = 10 * time.Minute // time to sign in at the provider
+)
+
+var (
+	ssoMu       sync.Mutex
+	ssoProvider *sso.Provider // discovered on the first use, so that the client starts while the provider is down
+)
+
+// oidcFlow : sso.Flow kept in a signed cookie until the callback
+type oidcFlow struct {
+	Flow    *sso.Flow `json:"flow"`
+	Next    string    `json:"next"` // path to return to after signing in
+	Expires int64     `json:"exp"`
+}
+
+func getSSOProvider() (*sso.Provider, error) {
+	ssoMu.Lock()
+	defer ssoMu.Unlock()
+	if ssoProvider != nil {
+		return ssoProvider, nil
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	p, err := sso.New(ctx, store.Get().SSOConfig())
+	if err != nil {
+		return nil, err
+	}
+	ssoProvider = p
+	return p, nil
+}
+
+// oidcLogin : redirect to the provider ([oidc] section)
+func oidcLogin(c echo.Context) error {
+	if !store.Get().OIDCEnabled {
+		return echo.ErrNotFound
+	}
+	p, err := getSSOProvider()
+	if err != nil {
+		log.Println(err)
+		return c.Render(http.StatusServiceUnavailable, "login.html", loginData{Error: "The identity provider is unavailable", OIDC: true})
+	}
+	url, flow, err := p.Begin()
+	if err != nil {
+		return err
+	}
+	next := safeNext(c.QueryParam("next"))
+	value, err := encodeSigned(purposeOIDC, &oidcFlow{Flow: flow, Next: next, Expires: time.Now().Add(oidcFlowTTL).Unix()})
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     oidcCookie,
+		Value:    value,
+		Path:     "/login/oidc",
+		MaxAge:   int(oidcFlowTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   store.Get().AuthCookieSecure,
+		SameSite: http.SameSiteLaxMode, // sent on the redirect back from the provider
+	})
+	return c.Redirect(http.StatusFound, url)
+}
+
+// oidcCallback : sign in the user of the ID token (created on the first login)
+func oidcCallback(c echo.Context, uc protobuf.UserServiceClient) error {
+	if !store.Get().OIDCEnabled {
+		return echo.ErrNotFound
+	}
+	failed := func(msg string, err error) error {
+		log.Println("OIDC login failed: ", err)
+		return c.Render(http.StatusUnauthorized, "login.html", loginData{Error: msg, OIDC: true})
+	}
+	if e := c.QueryParam("error"); e != "" { // e.g. access_denied
+		return failed("Sign in was canceled", &oidcError{e, c.QueryParam("error_description")})
+	}
+	flow := &oidcFlow{}
+	cookie, err := c.Cookie(oidcCookie)
+	if err == nil {
+		err = decodeSigned(purposeOIDC, cookie.Value, flow)
+	}
+	if err != nil || time.Now().Unix() > flow.Expires {
+		return failed("Sign in expired, please try again", err)
+	}
+	c.SetCookie(&http.Cookie{Name: oidcCookie, Path: "/login/oidc", MaxAge: -1, HttpOnly: true})
+	p, err := getSSOProvider()
+	if err != nil {
+		return failed("The identity provider is unavailable", err)
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	id, err := p.Finish(ctx, flow.Flow, c.QueryParam("state"), c.QueryParam("code"))
+	if err == sso.ErrDomainNotAllowed {
+		return failed("Your account is not allowed to sign in", err)
+	} else if err != nil {
+		return failed("Sign in failed, please try again", err)
+	}
+	res, err := uc.ExternalLogin(ctx, &protobuf.ExternalLoginRequest{
+		Issuer:   id.Issuer,
+		Subject:  id.Subject,
+		Email:    id.Email,
+		Username: id.Username(),
+	})
+	if err != nil {
+		return failed("Sign in failed, please try again", err)
+	}
+	if err := startSession(c, res.GetUser()); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, safeNext(flow.Next))
+}
+
+type oidcError struct {
+	code        string
+	description string
+}
+
+func (e *oidcError) Error() string {
+	return e.code + ": " + e.description
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"myTips/tipstocks/app/utils"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo"
+	"golang.org/x/time/rate"
+)
+
+// rateLimiter : token bucket per IP address ([client] rate_limit & rate_burst, hot-reloadable)
+type rateLimiter struct {
+	mu       sync.Mutex
+	limit    rate.Limit
+	burst    int
+	visitors map[string]*visitor
+	trusted  []netip.Prefix // [client] trusted_proxies
+	// forget idle IP addresses
+	lastCleanup time.Time
+}
+
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+const visitorTTL = 10 * time.Minute
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{visitors: map[string]*visitor{}}
+}
+
+// apply : change the limits of all the IP addresses at once
+func (rl *rateLimiter) apply(conf utils.Configs) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limit = rate.Limit(conf.ClientRateLimit)
+	if conf.ClientRateLimit == 0 {
+		rl.limit = rate.Inf
+	}
+	rl.burst = conf.ClientRateBurst
+	rl.trusted, _ = utils.ParsePrefixes(conf.ClientTrustedProxies) // checked by Validate
+	for _, v := range rl.visitors {
+		v.limiter.SetLimit(rl.limit)
+		v.limiter.SetBurst(rl.burst)
+	}
+}
+
+func (rl *rateLimiter) allow(ip string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	if rl.limit == rate.Inf {
+		return true
+	}
+	now := time.Now()
+	if now.Sub(rl.lastCleanup) > visitorTTL { // ("delete" is a handler of this package)
+		fresh := make(map[string]*visitor, len(rl.visitors))
+		for k, v := range rl.visitors {
+			if now.Sub(v.lastSeen) <= visitorTTL {
+				fresh[k] = v
+			}
+		}
+		rl.visitors = fresh
+		rl.lastCleanup = now
+	}
+	v, ok := rl.visitors[ip]
+	if !ok {
+		v = &visitor{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.visitors[ip] = v
+	}
+	v.lastSeen = now
+	return v.limiter.Allow()
+}
+
+func (rl *rateLimiter) middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !rl.allow(rl.clientIP(c.Request())) {
+			return c.String(http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+		}
+		return next(c)
+	}
+}
+
+// clientIP : address of the visitor, which is the address of the connection
+// unless it comes from a trusted proxy (echo's RealIP trusts X-Forwarded-For of anyone)
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	rl.mu.Lock()
+	trusted := rl.trusted
+	rl.mu.Unlock()
+	if !isTrusted(trusted, remote) {
+		return remote
+	}
+	// the last address which is not a trusted proxy (the ones before it can be forged by the visitor)
+	hops := []string{}
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(h, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !isTrusted(trusted, hops[i]) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return remote
+}
+
+func isTrusted(trusted []netip.Prefix, ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, p := range trusted {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
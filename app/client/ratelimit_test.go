@@ -0,0 +1,46 @@
+package main
+
+import (
+	"myTips/tipstocks/app/utils"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestClientIP : X-Forwarded-For & X-Real-IP are only trusted from [client] trusted_proxies
+func TestClientIP(t *testing.T) {
+	rl := newRateLimiter()
+	rl.apply(utils.Configs{ClientRateLimit: 1, ClientRateBurst: 1, ClientTrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}})
+	cases := []struct {
+		remote, forwarded, realIP, want string
+	}{
+		{"203.0.113.5:1234", "198.51.100.1", "198.51.100.2", "203.0.113.5"},         // not a proxy: forged headers
+		{"10.0.0.2:1234", "198.51.100.1", "", "198.51.100.1"},                       // trusted proxy
+		{"10.0.0.2:1234", "1.2.3.4, 198.51.100.1, 192.168.1.1", "", "198.51.100.1"}, // forged first hop
+		{"10.0.0.2:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"10.0.0.2:1234", "", "", "10.0.0.2"},
+		{"[2001:db8::1]:1234", "198.51.100.1", "", "2001:db8::1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+		if got := rl.clientIP(r); got != c.want {
+			t.Errorf("%v %q %q: got %v (want %v)", c.remote, c.forwarded, c.realIP, got, c.want)
+		}
+	}
+
+	// rotating the header doesn't give a new bucket
+	for i, ip := range []string{"1.1.1.1", "2.2.2.2"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "203.0.113.9:1"
+		r.Header.Set("X-Forwarded-For", ip)
+		if allowed := rl.allow(rl.clientIP(r)); allowed != (i == 0) {
+			t.Errorf("request %v allowed: %v", i, allowed)
+		}
+	}
+}
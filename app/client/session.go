@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	sessionCookie = "tipstocks_session"
+	sessionUser   = "user"  // key of the *session in echo.Context
+	apiToken      = "token" // key of the personal access token of a JSON API request in echo.Context
+)
+
+// publicPaths : reachable without signing in
+var publicPaths = []string{"/login", "/signup", "/css/", "/img/"}
+
+// session : the user signed in, stored in a cookie signed with HMAC-SHA256 ([auth] session_secret)
+type session struct {
+	UserID   string `json:"uid"`
+	Username string `json:"name"`
+	Expires  int64  `json:"exp"` // unix time
+}
+
+var sessionKey []byte
+
+// setupSessionKey : [auth] session_secret, or a random key (sessions don't survive restarts)
+func setupSessionKey(conf utils.Configs) {
+	if conf.AuthSessionSecret != "" {
+		sessionKey = []byte(conf.AuthSessionSecret)
+		return
+	}
+	sessionKey = make([]byte, 32)
+	if _, err := rand.Read(sessionKey); err != nil {
+		log.Fatalln("cannot generate a session key: ", err)
+	}
+	log.Println("[auth] session_secret is blank: sessions are signed with a random key until restart")
+}
+
+// purposes of the signed cookies: the MAC covers the purpose, so that a cookie is never accepted as another one
+const (
+	purposeSession = "session"
+	purposeOIDC    = "oidc"
+	purposeCSRF    = "csrf"
+)
+
+func sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte(purpose + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeSigned : base64(JSON).base64(HMAC) of v for the cookies of purpose
+func encodeSigned(purpose string, v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + sign(purpose, payload), nil
+}
+
+// decodeSigned : v of encodeSigned unless the value was tampered with or signed for another purpose
+func decodeSigned(purpose, value string, v interface{}) error {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return errors.New("malformed cookie")
+	}
+	payload, sig := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(sign(purpose, payload))) {
+		return errors.New("invalid cookie signature")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeSession(value string) (*session, error) {
+	s := &session{}
+	if err := decodeSigned(purposeSession, value, s); err != nil {
+		return nil, err
+	}
+	if s.UserID == "" || s.Username == "" {
+		return nil, errors.New("session without user")
+	}
+	if time.Now().Unix() > s.Expires {
+		return nil, errors.New("session expired")
+	}
+	return s, nil
+}
+
+// startSession : sign in the user for [auth] session_ttl
+func startSession(c echo.Context, user *protobuf.User) error {
+	conf := store.Get()
+	expires := time.Now().Add(conf.AuthSessionTTL)
+	value, err := encodeSigned(purposeSession, &session{UserID: user.GetId(), Username: user.GetUsername(), Expires: expires.Unix()})
+	if err != nil {
+		return err
+	}
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   conf.AuthCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func endSession(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   store.Get().AuthCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// currentSession : the user of the request (nil if not signed in)
+func currentSession(c echo.Context) *session {
+	s, _ := c.Get(sessionUser).(*session)
+	return s
+}
+
+// requireLogin : redirect to /login (401 for the JSON API) unless signed in
+// the JSON API also accepts "Authorization: Bearer <personal access token>", checked by the server
+func requireLogin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if token := patOf(c.Request()); token != "" {
+			c.Set(apiToken, token)
+			return next(c)
+		}
+		if cookie, err := c.Cookie(sessionCookie); err == nil {
+			if s, err := decodeSession(cookie.Value); err == nil {
+				c.Set(sessionUser, s)
+				return next(c)
+			}
+		}
+		path := c.Request().URL.Path
+		for _, p := range publicPaths {
+			if strings.HasPrefix(path, p) {
+				return next(c)
+			}
+		}
+		if strings.HasPrefix(path, apiPrefix) {
+			return c.JSON(http.StatusUnauthorized, apiError{Code: http.StatusUnauthorized, Status: "Unauthenticated", Message: "sign in at /login or send a personal access token in Authorization: Bearer"})
+		}
+		if c.Request().Method == http.MethodGet && path != "/" { // come back after signing in (e.g. invite links)
+			return c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request().RequestURI))
+		}
+		return c.Redirect(http.StatusFound, "/login")
+	}
+}
+
+// patOf : <token> of "Authorization: Bearer <token>" of a JSON API request
+// (blank for the other pages, and without [auth] enabled where the server checks no token)
+func patOf(r *http.Request) string {
+	if !strings.HasPrefix(r.URL.Path, apiPrefix) || !store.Get().AuthEnabled {
+		return ""
+	}
+	if v := r.Header.Get("Authorization"); len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+		return strings.TrimSpace(v[7:])
+	}
+	return ""
+}
+
+// csrfToken : token of the forms of s, which changes with every session ("" if not signed in)
+func csrfToken(s *session) string {
+	if s == nil {
+		return ""
+	}
+	return sign(purposeCSRF, fmt.Sprintf("%v|%v", s.UserID, s.Expires))
+}
+
+// requireCSRF : 403 unless the form posts the csrf token of the session (see csrfToken)
+func requireCSRF(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		want := csrfToken(currentSession(c))
+		if want == "" || !hmac.Equal([]byte(c.FormValue("csrf")), []byte(want)) {
+			return c.String(http.StatusForbidden, "Forbidden: invalid CSRF token, reload the page and try again")
+		}
+		return next(c)
+	}
+}
+
+// ----- pages ----- //
+// loginData : data of login.html
+type loginData struct {
+	Error string
+	OIDC  bool   // show "Sign in with SSO"
+	Next  string // path to return to after signing in
+}
+
+func loginPage(c echo.Context) error {
+	return c.Render(http.StatusOK, "login.html", loginData{OIDC: store.Get().OIDCEnabled, Next: safeNext(c.QueryParam("next"))})
+}
+
+func login(c echo.Context, uc protobuf.UserServiceClient) error {
+	ctx, cancel := requestContext()
+	defer cancel()
+	res, err := uc.Login(ctx, &protobuf.LoginRequest{Username: c.FormValue("username"), Password: c.FormValue("password")})
+	if err != nil {
+		log.Println("error while calling Login: ", err)
+		return c.Render(http.StatusUnauthorized, "login.html", loginData{Error: "Invalid username or password", OIDC: store.Get().OIDCEnabled, Next: safeNext(c.FormValue("next"))})
+	}
+	if err := startSession(c, res.GetUser()); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, safeNext(c.FormValue("next")))
+}
+
+func signupPage(c echo.Context) error {
+	return c.Render(http.StatusOK, "signup.html", "")
+}
+
+func signup(c echo.Context, uc protobuf.UserServiceClient) error {
+	if c.FormValue("password") != c.FormValue("confirm") {
+		return c.Render(http.StatusBadRequest, "signup.html", "Passwords don't match")
+	}
+	ctx, cancel := requestContext()
+	defer cancel()
+	res, err := uc.Signup(ctx, &protobuf.SignupRequest{Username: c.FormValue("username"), Password: c.FormValue("password")})
+	if err != nil {
+		log.Println("error while calling Signup: ", err)
+		return c.Render(http.StatusBadRequest, "signup.html", status.Convert(err).Message())
+	}
+	fmt.Println("New user signed up!: ", res.GetUser().GetUsername())
+	if err := startSession(c, res.GetUser()); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func logout(c echo.Context) error {
+	endSession(c)
+	selectWorkspace(c, "")
+	return c.Redirect(http.StatusFound, "/login")
+}
+
+func makeUserHandler(handler func(c echo.Context, uc protobuf.UserServiceClient) error, uc protobuf.UserServiceClient) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return handler(c, uc)
+	}
+}
+
+// ----- identity forwarding ----- //
+
+// workspaceHeader : workspace of a JSON API request with a personal access token
+const workspaceHeader = "X-Tipstocks-Workspace-Id"
+
+// userClient : TipServiceClient forwarding the user of the session & the workspace selected
+// in the gRPC metadata (utils.UserMetadataKey & utils.WorkspaceMetadataKey),
+// or the personal access token of the request instead of the service token
+type userClient struct {
+	protobuf.TipServiceClient
+	userID      string
+	token       string
+	workspaceID string
+}
+
+// asUser : pc acting on behalf of the user signed in to c (or of the owner of its token)
+func asUser(pc protobuf.TipServiceClient, c echo.Context) protobuf.TipServiceClient {
+	if token, ok := c.Get(apiToken).(string); ok {
+		return &userClient{TipServiceClient: pc, token: token, workspaceID: c.Request().Header.Get(workspaceHeader)}
+	}
+	s := currentSession(c)
+	if s == nil || s.UserID == "" { // the server rejects the calls without a user
+		return pc
+	}
+	return &userClient{TipServiceClient: pc, userID: s.UserID, workspaceID: currentWorkspaceID(c)}
+}
+
+func (u *userClient) with(ctx context.Context) context.Context {
+	if u.token != "" {
+		ctx = utils.WithBearerToken(ctx, u.token)
+	} else {
+		ctx = metadata.AppendToOutgoingContext(ctx, utils.UserMetadataKey, u.userID)
+	}
+	if u.workspaceID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, utils.WorkspaceMetadataKey, u.workspaceID)
+	}
+	return ctx
+}
+
+func (u *userClient) CreateTip(ctx context.Context, in *protobuf.CreateTipRequest, opts ...grpc.CallOption) (*protobuf.CreateTipResponse, error) {
+	return u.TipServiceClient.CreateTip(u.with(ctx), in, opts...)
+}
+
+func (u *userClient) DeleteTip(ctx context.Context, in *protobuf.DeleteTipRequest, opts ...grpc.CallOption) (*protobuf.DeleteTipResponse, error) {
+	return u.TipServiceClient.DeleteTip(u.with(ctx), in, opts...)
+}
+
+func (u *userClient) GetTip(ctx context.Context, in *protobuf.GetTipRequest, opts ...grpc.CallOption) (*protobuf.GetTipResponse, error) {
+	return u.TipServiceClient.GetTip(u.with(ctx), in, opts...)
+}
+
+func (u *userClient) UpdateTip(ctx context.Context, in *protobuf.UpdateTipRequest, opts ...grpc.CallOption) (*protobuf.UpdateTipResponse, error) {
+	return u.TipServiceClient.UpdateTip(u.with(ctx), in, opts...)
+}
+
+func (u *userClient) AllTips(ctx context.Context, in *protobuf.AllTipsRequest, opts ...grpc.CallOption) (protobuf.TipService_AllTipsClient, error) {
+	return u.TipServiceClient.AllTips(u.with(ctx), in, opts...)
+}
+
+func (u *userClient) SearchTips(ctx context.Context, in *protobuf.SearchTipsRequest, opts ...grpc.CallOption) (protobuf.TipService_SearchTipsClient, error) {
+	return u.TipServiceClient.SearchTips(u.with(ctx), in, opts...)
+}
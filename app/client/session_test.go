@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"io"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUsers : UserServiceClient knowing alice with the password "secret"
+type fakeUsers struct {
+	protobuf.UserServiceClient
+	signups int
+}
+
+func (f *fakeUsers) Login(ctx context.Context, in *protobuf.LoginRequest, opts ...grpc.CallOption) (*protobuf.LoginResponse, error) {
+	if in.GetUsername() != "alice" || in.GetPassword() != "secret" {
+		return nil, status.Error(codes.Unauthenticated, "invalid username or password")
+	}
+	return &protobuf.LoginResponse{User: &protobuf.User{Id: "1", Username: "alice"}}, nil
+}
+
+func (f *fakeUsers) Signup(ctx context.Context, in *protobuf.SignupRequest, opts ...grpc.CallOption) (*protobuf.SignupResponse, error) {
+	if in.GetUsername() == "alice" {
+		return nil, status.Error(codes.AlreadyExists, "username is taken")
+	}
+	f.signups++
+	return &protobuf.SignupResponse{User: &protobuf.User{Id: "2", Username: in.GetUsername()}}, nil
+}
+
+// nopRenderer : renders the name of the template only
+type nopRenderer struct{}
+
+func (nopRenderer) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	_, err := io.WriteString(w, name)
+	return err
+}
+
+func setupTestSession() {
+	store = utils.NewStore(utils.Configs{AuthEnabled: true, AuthSessionTTL: time.Hour, ClientRequestTimeout: time.Second})
+	sessionKey = []byte("test key")
+}
+
+// postForm : response of handler to a form posted to path
+func postForm(handler echo.HandlerFunc, path string, form url.Values) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.Renderer = nopRenderer{}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	handler(e.NewContext(req, rec))
+	return rec
+}
+
+// sessionOf : session of the cookie set by rec (nil if none)
+func sessionOf(rec *httptest.ResponseRecorder) *session {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie && cookie.HttpOnly {
+			s, _ := decodeSession(cookie.Value)
+			return s
+		}
+	}
+	return nil
+}
+
+// TestLogin : a session is started for valid credentials only, then the user goes back to next
+func TestLogin(t *testing.T) {
+	setupTestSession()
+	handler := makeUserHandler(login, &fakeUsers{})
+	cases := []struct {
+		password, next string
+		code           int
+		location       string
+	}{
+		{"secret", "/invite/abc", http.StatusFound, "/invite/abc"},
+		{"secret", "https://evil.example/", http.StatusFound, "/"},
+		{"wrong", "/invite/abc", http.StatusUnauthorized, ""},
+	}
+	for _, c := range cases {
+		rec := postForm(handler, "/login", url.Values{"username": {"alice"}, "password": {c.password}, "next": {c.next}})
+		s := sessionOf(rec)
+		if rec.Code != c.code || rec.Header().Get("Location") != c.location || (s != nil) != (c.code == http.StatusFound) {
+			t.Errorf("%q %q: %v %q, session %+v", c.password, c.next, rec.Code, rec.Header().Get("Location"), s)
+		}
+		if s != nil && (s.UserID != "1" || s.Username != "alice") {
+			t.Errorf("unexpected session %+v", s)
+		}
+	}
+}
+
+// TestSignup : accounts are created when both passwords match, and their user is signed in
+func TestSignup(t *testing.T) {
+	setupTestSession()
+	users := &fakeUsers{}
+	handler := makeUserHandler(signup, users)
+	cases := []struct {
+		username, password, confirm string
+		code                        int
+	}{
+		{"bob", "secret", "secret", http.StatusFound},
+		{"bob", "secret", "typo", http.StatusBadRequest},
+		{"alice", "secret", "secret", http.StatusBadRequest}, // taken
+	}
+	for _, c := range cases {
+		rec := postForm(handler, "/signup", url.Values{"username": {c.username}, "password": {c.password}, "confirm": {c.confirm}})
+		if s := sessionOf(rec); rec.Code != c.code || (s != nil) != (c.code == http.StatusFound) {
+			t.Errorf("%+v: %v, session %+v", c, rec.Code, s)
+		}
+	}
+	if users.signups != 1 {
+		t.Errorf("%v users signed up", users.signups)
+	}
+}
+
+// TestSessionCookie : cookies are only accepted with a valid signature for a session of a user before they expire
+func TestSessionCookie(t *testing.T) {
+	setupTestSession()
+	valid, _ := encodeSigned(purposeSession, &session{UserID: "1", Username: "alice", Expires: time.Now().Add(time.Minute).Unix()})
+	expired, _ := encodeSigned(purposeSession, &session{UserID: "1", Username: "alice", Expires: time.Now().Add(-time.Minute).Unix()})
+	forged, _ := encodeSigned(purposeSession, &session{UserID: "2", Username: "root", Expires: time.Now().Add(time.Minute).Unix()})
+	payload, sig := valid[:strings.LastIndex(valid, ".")], valid[strings.LastIndex(valid, ".")+1:]
+	forgedPayload := forged[:strings.LastIndex(forged, ".")]
+	// a cookie of the OIDC flow, which anyone gets from /login/oidc
+	flow, _ := encodeSigned(purposeOIDC, &oidcFlow{Next: "/", Expires: time.Now().Add(time.Minute).Unix()})
+	noUser, _ := encodeSigned(purposeSession, &session{Expires: time.Now().Add(time.Minute).Unix()})
+
+	if s, err := decodeSession(valid); err != nil || s.UserID != "1" || s.Username != "alice" {
+		t.Errorf("valid session: %+v %v", s, err)
+	}
+	for name, value := range map[string]string{
+		"expired":       expired,
+		"other payload": forgedPayload + "." + sig,
+		"no signature":  payload,
+		"blank":         "",
+		"oidc flow":     flow,
+		"without user":  noUser,
+	} {
+		if s, err := decodeSession(value); err == nil {
+			t.Errorf("%v session is accepted: %+v", name, s)
+		}
+	}
+	sessionKey = []byte("other key") // e.g. [auth] session_secret was changed
+	if _, err := decodeSession(valid); err == nil {
+		t.Error("session signed with another key is accepted")
+	}
+}
+
+// TestSafeNext : only local paths are followed after signing in
+func TestSafeNext(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"/invite/abc?x=1", "/invite/abc?x=1"},
+		{"", "/"},
+		{"https://evil.example/", "/"},
+		{"//evil.example/", "/"},
+		{"/\\evil.example/", "/"},
+		{"/\t/evil.example/", "/"},
+		{"/\n/evil.example/", "/"},
+		{"javascript:alert(1)", "/"},
+		{"evil.example", "/"},
+	}
+	for _, c := range cases {
+		if got := safeNext(c.in); got != c.want {
+			t.Errorf("safeNext(%q) = %q (want %q)", c.in, got, c.want)
+		}
+	}
+}
+
+// TestRequireLoginToken : the JSON API forwards "Authorization: Bearer <token>" instead of the service token
+func TestRequireLoginToken(t *testing.T) {
+	setupTestSession()
+	var forwarded map[string]string
+	handler := requireLogin(func(c echo.Context) error {
+		u, ok := asUser(nil, c).(*userClient)
+		if !ok {
+			return c.NoContent(http.StatusOK)
+		}
+		forwarded, _ = utils.BearerToken("service", false).GetRequestMetadata(u.with(context.Background()))
+		return c.NoContent(http.StatusOK)
+	})
+	cases := []struct {
+		path, authorization string
+		code                int
+		forwarded           string
+	}{
+		{"/api/v1/tips", "Bearer tst_abc", http.StatusOK, "Bearer tst_abc"},
+		{"/api/v1/tips", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, ""},
+		{"/api/v1/tips", "", http.StatusUnauthorized, ""},
+		{"/tips/1", "Bearer tst_abc", http.StatusFound, ""}, // pages need a session
+	}
+	for _, c := range cases {
+		forwarded = nil
+		req := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler(echo.New().NewContext(req, rec))
+		if rec.Code != c.code || forwarded["authorization"] != c.forwarded && c.forwarded != "" {
+			t.Errorf("%v %q: %v, forwarded %v", c.path, c.authorization, rec.Code, forwarded)
+		}
+	}
+
+	store = utils.NewStore(utils.Configs{AuthEnabled: false})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tips", nil)
+	req.Header.Set("Authorization", "Bearer tst_abc")
+	if handler(echo.New().NewContext(req, rec)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("token is accepted without [auth] enabled: %v", rec.Code)
+	}
+}
+
+// TestRequireCSRF : forms are only accepted with the csrf token of the session
+func TestRequireCSRF(t *testing.T) {
+	setupTestSession()
+	alice := &session{UserID: "1", Username: "alice", Expires: time.Now().Add(time.Hour).Unix()}
+	bob := &session{UserID: "2", Username: "bob", Expires: time.Now().Add(time.Hour).Unix()}
+	handler := requireCSRF(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	cases := []struct {
+		session *session
+		token   string
+		want    int
+	}{
+		{alice, csrfToken(alice), http.StatusOK},
+		{alice, csrfToken(bob), http.StatusForbidden},
+		{alice, "", http.StatusForbidden},
+		{nil, "", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/remove", strings.NewReader(url.Values{"id": {"x"}, "csrf": {c.token}}.Encode()))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+		rec := httptest.NewRecorder()
+		ctx := echo.New().NewContext(req, rec)
+		if c.session != nil {
+			ctx.Set(sessionUser, c.session)
+		}
+		if handler(ctx); rec.Code != c.want {
+			t.Errorf("%+v %q: %v (want %v)", c.session, c.token, rec.Code, c.want)
+		}
+	}
+}
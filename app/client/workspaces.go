@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// workspaceCookie : id of the workspace selected in the web client (blank for the personal one)
+// not signed: the gRPC server checks the membership on every call
+const workspaceCookie = "tipstocks_workspace"
+
+// workspacesData : data of workspaces.html
+type workspacesData struct {
+	Workspaces []*protobuf.Workspace
+	Current    *protobuf.Workspace
+	Members    []*protobuf.Member
+	UserID     string
+	InviteURL  string
+	Error      string
+}
+
+// inviteData : data of invite.html
+type inviteData struct {
+	Token string
+	Error string
+}
+
+// currentWorkspaceID : the workspace of the requests to the gRPC server
+func currentWorkspaceID(c echo.Context) string {
+	if cookie, err := c.Cookie(workspaceCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func selectWorkspace(c echo.Context, id string) {
+	c.SetCookie(&http.Cookie{
+		Name:     workspaceCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   store.Get().AuthCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// userContext : requestContext on behalf of the user signed in to c
+func userContext(c echo.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := requestContext()
+	if s := currentSession(c); s != nil && s.UserID != "" { // never a blank user
+		ctx = metadata.AppendToOutgoingContext(ctx, utils.UserMetadataKey, s.UserID)
+	}
+	return ctx, cancel
+}
+
+func workspacesPage(c echo.Context, wc protobuf.WorkspaceServiceClient) error {
+	return renderWorkspaces(c, wc, http.StatusOK, "", "")
+}
+
+// renderWorkspaces : workspaces.html with the members of the current workspace
+func renderWorkspaces(c echo.Context, wc protobuf.WorkspaceServiceClient, code int, inviteURL, message string) error {
+	ctx, cancel := userContext(c)
+	defer cancel()
+	data := workspacesData{InviteURL: inviteURL, Error: message}
+	if s := currentSession(c); s != nil {
+		data.UserID = s.UserID
+	}
+	res, err := wc.ListWorkspaces(ctx, &protobuf.ListWorkspacesRequest{})
+	if err != nil {
+		log.Println("error while calling ListWorkspaces: ", err)
+		data.Error = status.Convert(err).Message()
+		return c.Render(http.StatusInternalServerError, "workspaces.html", data)
+	}
+	data.Workspaces = res.GetWorkspaces()
+	selected := currentWorkspaceID(c)
+	for _, w := range data.Workspaces {
+		if w.GetId() == selected || (selected == "" && w.GetPersonal()) {
+			data.Current = w
+		}
+	}
+	if data.Current == nil { // removed from the workspace: back to the personal one
+		selectWorkspace(c, "")
+		for _, w := range data.Workspaces {
+			if w.GetPersonal() {
+				data.Current = w
+			}
+		}
+	}
+	if data.Current != nil {
+		members, err := wc.ListMembers(ctx, &protobuf.ListMembersRequest{WorkspaceId: data.Current.GetId()})
+		if err != nil {
+			log.Println("error while calling ListMembers: ", err)
+		} else {
+			data.Members = members.GetMembers()
+		}
+	}
+	return c.Render(code, "workspaces.html", data)
+}
+
+func createWorkspace(c echo.Context, wc protobuf.WorkspaceServiceClient) error {
+	ctx, cancel := userContext(c)
+	defer cancel()
+	res, err := wc.CreateWorkspace(ctx, &protobuf.CreateWorkspaceRequest{Name: c.FormValue("name")})
+	if err != nil {
+		log.Println("error while calling CreateWorkspace: ", err)
+		return renderWorkspaces(c, wc, http.StatusBadRequest, "", status.Convert(err).Message())
+	}
+	fmt.Println("New workspace created!: ", res.GetWorkspace().GetId())
+	selectWorkspace(c, res.GetWorkspace().GetId())
+	return c.Redirect(http.StatusFound, "/workspaces")
+}
+
+func switchWorkspace(c echo.Context) error {
+	selectWorkspace(c, c.FormValue("id"))
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func inviteMember(c echo.Context, wc protobuf.WorkspaceServiceClient) error {
+	ctx, cancel := userContext(c)
+	defer cancel()
+	res, err := wc.CreateInvite(ctx, &protobuf.CreateInviteRequest{WorkspaceId: c.FormValue("id"), Role: c.FormValue("role")})
+	if err != nil {
+		log.Println("error while calling CreateInvite: ", err)
+		return renderWorkspaces(c, wc, http.StatusBadRequest, "", status.Convert(err).Message())
+	}
+	req := c.Request()
+	inviteURL := fmt.Sprintf("%v://%v/invite/%v", c.Scheme(), req.Host, res.GetToken())
+	expires := time.Unix(res.GetExpiresAt(), 0).Format("2006-01-02 15:04")
+	return renderWorkspaces(c, wc, http.StatusOK, inviteURL, "The link expires at "+expires)
+}
+
+func removeMember(c echo.Context, wc protobuf.WorkspaceServiceClient) error {
+	ctx, cancel := userContext(c)
+	defer cancel()
+	_, err := wc.RemoveMember(ctx, &protobuf.RemoveMemberRequest{WorkspaceId: c.FormValue("id"), UserId: c.FormValue("user_id")})
+	if err != nil {
+		log.Println("error while calling RemoveMember: ", err)
+		return renderWorkspaces(c, wc, http.StatusBadRequest, "", status.Convert(err).Message())
+	}
+	return c.Redirect(http.StatusFound, "/workspaces")
+}
+
+func invitePage(c echo.Context) error {
+	return c.Render(http.StatusOK, "invite.html", inviteData{Token: c.Param("token")})
+}
+
+func acceptInvite(c echo.Context, wc protobuf.WorkspaceServiceClient) error {
+	ctx, cancel := userContext(c)
+	defer cancel()
+	token := c.Param("token")
+	res, err := wc.AcceptInvite(ctx, &protobuf.AcceptInviteRequest{Token: token})
+	if err != nil {
+		log.Println("error while calling AcceptInvite: ", err)
+		return c.Render(http.StatusBadRequest, "invite.html", inviteData{Token: token, Error: status.Convert(err).Message()})
+	}
+	selectWorkspace(c, res.GetWorkspace().GetId())
+	return c.Redirect(http.StatusFound, "/")
+}
+
+func makeWorkspaceHandler(handler func(c echo.Context, wc protobuf.WorkspaceServiceClient) error, wc protobuf.WorkspaceServiceClient) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return handler(c, wc)
+	}
+}
+
+// safeNext : local path to return to after signing in ("/" unless it stays on this site)
+// browsers drop tabs & newlines of URLs, so "/\t/evil.example" would be "//evil.example"
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.ContainsAny(next, "\t\r\n") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// scopes of the tokens
+const (
+	scopeTipsRead    = "tips:read"
+	scopeTipsWrite   = "tips:write"
+	scopeTokensAdmin = "tokens:admin"
+	scopeUsersAuth   = "users:auth" // sign-up & login of the web client
+)
+
+var allScopes = []string{scopeTipsRead, scopeTipsWrite, scopeTokensAdmin, scopeUsersAuth}
+
+// tokenScopes : scopes of the personal access tokens (users:auth is only for the service token of the web client)
+var tokenScopes = []string{scopeTipsRead, scopeTipsWrite, scopeTokensAdmin}
+
+// methodScopes : scope required by each RPC (the other RPCs, e.g. reflection, only require a valid token)
+var methodScopes = map[string]string{
+	tipMethod("CreateTip"):      scopeTipsWrite,
+	tipMethod("DeleteTip"):      scopeTipsWrite,
+	tipMethod("UpdateTip"):      scopeTipsWrite,
+	tipMethod("GetTip"):         scopeTipsRead,
+	tipMethod("AllTips"):        scopeTipsRead,
+	tipMethod("SearchTips"):     scopeTipsRead,
+	tokenMethod("CreateToken"):  scopeTokensAdmin,
+	tokenMethod("ListTokens"):   scopeTokensAdmin,
+	tokenMethod("RevokeToken"):  scopeTokensAdmin,
+	userMethod("Signup"):        scopeUsersAuth,
+	userMethod("Login"):         scopeUsersAuth,
+	userMethod("ExternalLogin"): scopeUsersAuth,
+	// the roles in the workspaces are checked by WorkspaceService itself
+	workspaceMethod("ListWorkspaces"):  scopeTipsRead,
+	workspaceMethod("ListMembers"):     scopeTipsRead,
+	workspaceMethod("CreateWorkspace"): scopeTipsWrite,
+	workspaceMethod("RemoveMember"):    scopeTipsWrite,
+	workspaceMethod("CreateInvite"):    scopeTipsWrite,
+	workspaceMethod("AcceptInvite"):    scopeTipsWrite,
+}
+
+// publicServices : callable without a token (health checks of docker-compose & load balancers)
+var publicServices = []string{"/grpc.health.v1.Health/"}
+
+func tipMethod(name string) string {
+	return "/" + protobuf.TipService_ServiceDesc.ServiceName + "/" + name
+}
+
+func tokenMethod(name string) string {
+	return "/" + protobuf.TokenService_ServiceDesc.ServiceName + "/" + name
+}
+
+func userMethod(name string) string {
+	return "/" + protobuf.UserService_ServiceDesc.ServiceName + "/" + name
+}
+
+func workspaceMethod(name string) string {
+	return "/" + protobuf.WorkspaceService_ServiceDesc.ServiceName + "/" + name
+}
+
+// principal : the caller authenticated by its bearer token
+type principal struct {
+	TokenID string // blank for the service token
+	Name    string
+	Scopes  []string
+	UserID  string // owner of the token, or the user of the web client forwarded with the service token
+	// Unscoped : the service token without a user, asking for every workspace (utils.UnscopedMetadataKey)
+	Unscoped bool
+}
+
+func (p *principal) hasScope(scope string) bool {
+	return containsScope(p.Scopes, scope)
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// callerOf : principal of the request (nil while [auth] enabled = false)
+func callerOf(ctx context.Context) *principal {
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return p
+}
+
+// userOf : user of the request (blank for the service token without a user & while [auth] enabled = false)
+func userOf(ctx context.Context) string {
+	if p := callerOf(ctx); p != nil {
+		return p.UserID
+	}
+	return ""
+}
+
+// requireUserOrUnscoped : the user of the request, or "" for the callers allowed to access everything
+// (the service token with utils.UnscopedMetadataKey, and every request while [auth] enabled = false)
+func requireUserOrUnscoped(ctx context.Context) (string, error) {
+	p := callerOf(ctx)
+	switch {
+	case p == nil || p.Unscoped:
+		return "", nil
+	case p.UserID == "":
+		return "", status.Errorf(codes.Unauthenticated, "no user: forward %v with the service token (or %v: true to access every user)", utils.UserMetadataKey, utils.UnscopedMetadataKey)
+	}
+	return p.UserID, nil
+}
+
+// authenticator : validates "authorization: Bearer <token>" of every request
+// the service token of the web client comes from [auth] service_token, personal access tokens from MongoDB
+type authenticator struct {
+	enabled     bool
+	serviceHash []byte
+}
+
+func newAuthenticator(conf utils.Configs) *authenticator {
+	a := &authenticator{enabled: conf.AuthEnabled}
+	if conf.AuthServiceToken != "" {
+		h := sha256.Sum256([]byte(conf.AuthServiceToken))
+		a.serviceHash = h[:]
+	}
+	return a
+}
+
+// unary : grpc.UnaryInterceptor
+func (a *authenticator) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// stream : grpc.StreamInterceptor
+func (a *authenticator) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate : Unauthenticated without a valid token, PermissionDenied without the scope of the method
+func (a *authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !a.enabled {
+		return ctx, nil
+	}
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return ctx, nil
+		}
+	}
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "missing bearer token in the authorization metadata")
+	}
+	p, err := a.lookup(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if scope, ok := methodScopes[method]; ok && !p.hasScope(scope) {
+		return nil, status.Errorf(codes.PermissionDenied, "token %q doesn't have the scope %v", p.Name, scope)
+	}
+	utils.Debugln("authenticated:", p.Name, method)
+	return context.WithValue(ctx, principalKey{}, p), nil
+}
+
+func (a *authenticator) lookup(ctx context.Context, token string) (*principal, error) {
+	hash := hashToken(token)
+	if a.serviceHash != nil {
+		h, _ := hex.DecodeString(hash)
+		if subtle.ConstantTimeCompare(h, a.serviceHash) == 1 {
+			return servicePrincipal(ctx)
+		}
+	}
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbPingTimeout)
+	defer cancel()
+	data := &tokenItem{}
+	update := bson.M{"$set": bson.M{"last_used_at": time.Now().Unix()}}
+	err := tokenCollection.FindOneAndUpdate(ctx, bson.M{"hash": hash}, update).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid or revoked token")
+	} else if err != nil {
+		return nil, dbError("couldn't verify the token in MongoDB", err)
+	}
+	if data.Owner == "" { // created before the owner was required: it would see every tip
+		return nil, status.Errorf(codes.PermissionDenied, "token %q has no owner: create a new one on behalf of a user", data.Name)
+	}
+	return &principal{TokenID: data.ID.Hex(), Name: data.Name, Scopes: data.Scopes, UserID: data.Owner}, nil
+}
+
+// bearerToken : <token> of "authorization: Bearer <token>" (blank if missing)
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, v := range md.Get("authorization") {
+		if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") {
+			return strings.TrimSpace(v[7:])
+		}
+	}
+	return ""
+}
+
+// servicePrincipal : the service token on behalf of the user signed in to the web client (utils.UserMetadataKey),
+// or without a user for administration, which is only unscoped with utils.UnscopedMetadataKey
+func servicePrincipal(ctx context.Context) (*principal, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	p := &principal{Name: "service", Scopes: allScopes}
+	if v := md.Get(utils.UserMetadataKey); len(v) > 0 {
+		if strings.TrimSpace(v[0]) == "" {
+			return nil, status.Errorf(codes.Unauthenticated, "blank user in %v", utils.UserMetadataKey)
+		}
+		p.UserID = v[0]
+		return p, nil
+	}
+	if v := md.Get(utils.UnscopedMetadataKey); len(v) > 0 && v[0] == "true" {
+		p.Unscoped = true
+	}
+	return p, nil
+}
+
+// hashToken : SHA-256 of the secret (hex)
+// the secrets are 256-bit random values, so a fast hash is enough and allows an indexed lookup
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// ensureIndexes : unique indexes of the token hashes, usernames, OpenID Connect identities & personal workspaces
+// (called whenever MongoDB gets reachable)
+func ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	indexes := []struct {
+		coll  *mongo.Collection
+		model mongo.IndexModel
+	}{
+		{tokenCollection, mongo.IndexModel{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{userCollection, mongo.IndexModel{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)}},
+		{userCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "issuer", Value: 1}, {Key: "subject", Value: 1}},
+			// local accounts don't have these fields
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"issuer": bson.M{"$exists": true}}),
+		}},
+		{workspaceCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "personal_of", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"personal_of": bson.M{"$exists": true}}),
+		}},
+		{workspaceCollection, mongo.IndexModel{Keys: bson.D{{Key: "members.user_id", Value: 1}}}},
+		{workspaceCollection, mongo.IndexModel{Keys: bson.D{{Key: "invites.hash", Value: 1}}}},
+		{collection, mongo.IndexModel{Keys: bson.D{{Key: "workspace_id", Value: 1}}}},
+	}
+	for _, idx := range indexes {
+		if _, err := idx.coll.Indexes().CreateOne(ctx, idx.model); err != nil {
+			log.Printf("couldn't create the index of %v: %v\n", idx.coll.Name(), err)
+		}
+	}
+}
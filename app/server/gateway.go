@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// newGateway : HTTP/1.1 JSON gateway which transcodes requests to the gRPC server (routes: app/protobuf/tip.proto)
+// server-streaming RPCs are written as newline-delimited JSON ({"result": {...}} per line)
+func newGateway(ctx context.Context, conf utils.Configs) (*http.Server, error) {
+	opt, err := loopbackDialOption(conf)
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{opt}
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true, // tip_id instead of tipId
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+			},
+		}),
+	)
+	endpoint := fmt.Sprintf("localhost:%v", conf.ServerPort)
+	if err := protobuf.RegisterTipServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	if err := protobuf.RegisterTokenServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	if err := protobuf.RegisterWorkspaceServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, err
+	}
+	// OpenAPI spec generated from the same proto by protoc-gen-openapiv2 (tools/protoc.sh)
+	err = mux.HandlePath(http.MethodGet, "/v1/openapi.json", func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, "app/protobuf/tip.swagger.json")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%v", conf.GatewayPort),
+		Handler: mux,
+	}, nil
+}
+
+// loopbackDialOption : transport security for dialing the gRPC server from its own process
+func loopbackDialOption(conf utils.Configs) (grpc.DialOption, error) {
+	if !conf.TLSEnabled {
+		return grpc.WithInsecure(), nil
+	}
+	tlsConf, sslErr := conf.ClientTLSConfig() // presents the client certificate for mutual TLS
+	if sslErr != nil {
+		return nil, sslErr
+	}
+	return grpc.WithTransportCredentials(credentials.NewTLS(tlsConf)), nil
+}
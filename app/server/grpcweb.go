@@ -0,0 +1,41 @@
+package main
+
+import (
+	"myTips/tipstocks/app/utils"
+	"net/http"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+)
+
+// newGRPCWeb : wrap the gRPC server for browsers (gRPC-Web over HTTP/1.1, including server-streaming RPCs)
+func newGRPCWeb(s *grpc.Server, conf utils.Configs) *grpcweb.WrappedGrpcServer {
+	return grpcweb.WrapServer(s,
+		grpcweb.WithOriginFunc(func(origin string) bool {
+			return allowedOrigin(conf.CORSAllowedOrigins, origin)
+		}),
+		grpcweb.WithAllowedRequestHeaders(conf.CORSAllowedHeaders),
+		grpcweb.WithCorsForRegisteredEndpointsOnly(true),
+	)
+}
+
+// withGRPCWeb : route gRPC-Web requests (and their CORS preflights) to the wrapped server, others to next
+func withGRPCWeb(web *grpcweb.WrappedGrpcServer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if web.IsGrpcWebRequest(r) || web.IsAcceptableGrpcCorsRequest(r) {
+			web.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin : "*" in the allowed origins allows every origin
+func allowedOrigin(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
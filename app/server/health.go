@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	healthCheckInterval = 5 * time.Second // interval of pinging MongoDB while it is reachable
+	healthCheckTimeout  = 3 * time.Second
+)
+
+// healthServices : "" is the overall health of the server
+var healthServices = []string{"", protobuf.TipService_ServiceDesc.ServiceName}
+
+// setServingStatus : set the serving status of all services
+func setServingStatus(hs *health.Server, st healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range healthServices {
+		hs.SetServingStatus(service, st)
+	}
+}
+
+// healthCheck : check the health of the running server (used as the healthcheck of docker-compose)
+func healthCheck(conf utils.Configs) error {
+	opt, err := loopbackDialOption(conf)
+	if err != nil {
+		return err
+	}
+	cc, err := grpc.Dial(fmt.Sprintf("localhost:%v", conf.ServerPort), opt)
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	res, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("server is %v", res.GetStatus())
+	}
+	return nil
+}
@@ -2,77 +2,95 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"myTips/tipstocks/app/protobuf"
 	"myTips/tipstocks/app/utils"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
-func (*server) CreateTip(ctx context.Context, req *protobuf.CreateTipRequest) (*protobuf.CreateTipResponse, error) {
-	// log.Println("CreateTip requested!")
+func (srv *server) CreateTip(ctx context.Context, req *protobuf.CreateTipRequest) (*protobuf.CreateTipResponse, error) {
+	utils.Debugln("CreateTip requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := srv.withTimeout(ctx)
+	defer cancel()
+	ws, err := currentWorkspace(ctx, roleEditor)
+	if err != nil {
+		return nil, err
+	}
 	tip := req.GetTip()
 	data := tipItem{
 		Title:       tip.GetTitle(),
 		URL:         tip.GetUrl(),
 		Description: tip.GetDescription(),
 		Image:       tip.GetImage(),
+		Pages:       tip.GetPages(),
+		Embed:       convertEmbedToData(tip.GetEmbed()),
+		Owner:       userOf(ctx),
+		WorkspaceID: ws,
 	}
 	res, err := collection.InsertOne(ctx, data)
 	if err != nil {
-		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Internal error: %v\n", err),
-		)
+		return nil, dbError("couldn't create a tip in MongoDB", err)
 	}
 	objID, ok := res.InsertedID.(primitive.ObjectID) // type assertion
 	if !ok {
 		return nil, status.Errorf(
 			codes.Internal,
-			fmt.Sprintf("InsertedID cannot be converted to objID"),
+			"InsertedID cannot be converted to objID",
 		)
 	}
 	data.ID = objID
 	return &protobuf.CreateTipResponse{Tip: convertDataToTip(&data)}, nil
 }
 
-func (*server) DeleteTip(ctx context.Context, req *protobuf.DeleteTipRequest) (*protobuf.DeleteTipResponse, error) {
-	// log.Println("DeleteTip requested!")
+func (srv *server) DeleteTip(ctx context.Context, req *protobuf.DeleteTipRequest) (*protobuf.DeleteTipResponse, error) {
+	utils.Debugln("DeleteTip requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := srv.withTimeout(ctx)
+	defer cancel()
 	tipID := req.GetTipId()
 	objID, err := primitive.ObjectIDFromHex(tipID) // hex string -> ObjectID
 	if err != nil {
 		return nil, status.Errorf(
 			codes.InvalidArgument,
-			fmt.Sprintf("cannot parse id: %v\n", err),
+			"cannot parse id: %v\n", err,
 		)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	filter := bson.M{"_id": objID} // bson map of filtered id
+	filter, err := tipScope(ctx, roleEditor, bson.M{"_id": objID}) // bson map of filtered id
+	if err != nil {
+		return nil, err
+	}
 	res, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
-		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("couldn't delete a tip in MongoDB: %v", err),
-		)
+		return nil, dbError("couldn't delete a tip in MongoDB", err)
 	} else if res.DeletedCount == 0 {
 		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("couldn't delete a tip in MongoDB: %v", err),
+			codes.NotFound,
+			"cannot find a tip with id: %v", tipID,
 		)
 	}
 	return &protobuf.DeleteTipResponse{
@@ -80,73 +98,204 @@ func (*server) DeleteTip(ctx context.Context, req *protobuf.DeleteTipRequest) (*
 	}, nil
 }
 
-func (*server) AllTips(req *protobuf.AllTipsRequest, stream protobuf.TipService_AllTipsServer) error {
-	// log.Println("AllTips requested!")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (srv *server) GetTip(ctx context.Context, req *protobuf.GetTipRequest) (*protobuf.GetTipResponse, error) {
+	utils.Debugln("GetTip requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := srv.withTimeout(ctx)
+	defer cancel()
+	tipID := req.GetTipId()
+	objID, err := primitive.ObjectIDFromHex(tipID) // hex string -> ObjectID
+	if err != nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"cannot parse id: %v\n", err,
+		)
+	}
+	data := &tipItem{}
+	filter, err := tipScope(ctx, roleViewer, bson.M{"_id": objID})
+	if err != nil {
+		return nil, err
+	}
+	err = collection.FindOne(ctx, filter).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(
+			codes.NotFound,
+			"cannot find a tip with id: %v", tipID,
+		)
+	} else if err != nil {
+		return nil, dbError("couldn't find a tip in MongoDB", err)
+	}
+	return &protobuf.GetTipResponse{Tip: convertDataToTip(data)}, nil
+}
+
+func (srv *server) UpdateTip(ctx context.Context, req *protobuf.UpdateTipRequest) (*protobuf.UpdateTipResponse, error) {
+	utils.Debugln("UpdateTip requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := srv.withTimeout(ctx)
 	defer cancel()
-	cur, err := findTips(ctx, primitive.D{{}}) // using primitive.D as filter without condition
-	defer cur.Close(ctx)
+	tip := req.GetTip()
+	objID, err := primitive.ObjectIDFromHex(tip.GetId()) // hex string -> ObjectID
+	if err != nil {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"cannot parse id: %v\n", err,
+		)
+	}
+	// blank fields are not overwritten
+	fields := bson.M{}
+	if tip.GetTitle() != "" {
+		fields["title"] = tip.GetTitle()
+	}
+	if tip.GetUrl() != "" {
+		fields["url"] = tip.GetUrl()
+	}
+	if tip.GetDescription() != "" {
+		fields["description"] = tip.GetDescription()
+	}
+	if tip.GetImage() != "" {
+		fields["image"] = tip.GetImage()
+	}
+	if len(fields) == 0 { // {"$set": {}} is rejected by MongoDB
+		return nil, status.Error(codes.InvalidArgument, "nothing to update: every field is blank")
+	}
+	data := &tipItem{}
+	filter, err := tipScope(ctx, roleEditor, bson.M{"_id": objID})
+	if err != nil {
+		return nil, err
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": fields}, opts).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(
+			codes.NotFound,
+			"cannot find a tip with id: %v", tip.GetId(),
+		)
+	} else if err != nil {
+		return nil, dbError("couldn't update a tip in MongoDB", err)
+	}
+	return &protobuf.UpdateTipResponse{Tip: convertDataToTip(data)}, nil
+}
+
+func (srv *server) AllTips(req *protobuf.AllTipsRequest, stream protobuf.TipService_AllTipsServer) error {
+	utils.Debugln("AllTips requested!")
+	if err := checkDB(); err != nil {
+		return err
+	}
+	ctx, cancel := srv.withTimeout(stream.Context()) // canceled when the client goes away
+	defer cancel()
+	// pagination: skip "offset" tips and return "limit" tips at most (0 means no limit)
+	if req.GetOffset() < 0 || req.GetLimit() < 0 {
+		return status.Errorf(
+			codes.InvalidArgument,
+			"offset and limit must not be negative: %v, %v", req.GetOffset(), req.GetLimit(),
+		)
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetSkip(req.GetOffset()).SetLimit(req.GetLimit())
+	filter, err := tipScope(ctx, roleViewer, bson.M{})
+	if err != nil {
+		return err
+	}
+	cur, err := findTips(ctx, filter, opts) // the tips in the workspace of the caller
+	if err != nil {
+		return err
+	}
+	defer closeCursor(cur)
 	for cur.Next(ctx) { // cursor iterator
 		data := &tipItem{}
 		err = cur.Decode(data) // decode cursor to data struct
 		if err != nil {
 			return status.Errorf(
 				codes.Internal,
-				fmt.Sprintf("couldn't convert to tip: %v", err),
+				"couldn't convert to tip: %v", err,
 			)
 		}
-		stream.Send(&protobuf.AllTipsResponse{
+		err = stream.Send(&protobuf.AllTipsResponse{
 			Tip: convertDataToTip(data),
 		})
+		if err != nil { // the client has gone away
+			return err
+		}
 	}
 	if err := cur.Err(); err != nil {
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Internal error: %v", err),
-		)
+		return dbError("couldn't iterate tips from MongoDB", err)
 	}
 	return nil
 }
 
-func (*server) SearchTips(req *protobuf.SearchTipsRequest, stream protobuf.TipService_SearchTipsServer) error {
-	// log.Println("SearchTips requested!")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (srv *server) SearchTips(req *protobuf.SearchTipsRequest, stream protobuf.TipService_SearchTipsServer) error {
+	utils.Debugln("SearchTips requested!")
+	if err := checkDB(); err != nil {
+		return err
+	}
+	ctx, cancel := srv.withTimeout(stream.Context()) // canceled when the client goes away
 	defer cancel()
 	// title filtering: regex with case-insensitive option as "i"
-	filter := primitive.D{
-		{Key: "title", Value: primitive.Regex{Pattern: req.GetTipTitle(), Options: "i"}},
+	filter, err := tipScope(ctx, roleViewer, bson.M{
+		"title": primitive.Regex{Pattern: req.GetTipTitle(), Options: "i"},
+	})
+	if err != nil {
+		return err
 	}
 	cur, err := findTips(ctx, filter)
-	defer cur.Close(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(cur)
 	for cur.Next(ctx) { // cursor iterator
 		data := &tipItem{}
 		err = cur.Decode(data) // decode cursor to data struct
 		if err != nil {
 			return status.Errorf(
 				codes.Internal,
-				fmt.Sprintf("couldn't convert to tip: %v", err),
+				"couldn't convert to tip: %v", err,
 			)
 		}
-		stream.Send(&protobuf.SearchTipsResponse{
+		err = stream.Send(&protobuf.SearchTipsResponse{
 			Tip: convertDataToTip(data),
 		})
+		if err != nil { // the client has gone away
+			return err
+		}
 	}
 	if err := cur.Err(); err != nil {
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Internal error: %v", err),
-		)
+		return dbError("couldn't iterate tips from MongoDB", err)
 	}
 	return nil
 }
 
-func findTips(ctx context.Context, filter interface{}) (*mongo.Cursor, error) {
-	cur, err := collection.Find(ctx, filter)
+// withTimeout : derive a context from the caller's one, limited by the server-side maximum
+func (srv *server) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, srv.conf.Get().ServerMaxTimeout) // the earlier deadline wins
+}
+
+// closeCursor : kill the cursor in MongoDB even if the request context is already done
+func closeCursor(cur *mongo.Cursor) {
+	ctx, cancel := context.WithTimeout(context.Background(), dbPingTimeout)
+	defer cancel()
+	cur.Close(ctx)
+}
+
+// ownedBy : limit filter to the documents (tokens) owned by the user of the request
+// (only the unscoped callers, see requireUserOrUnscoped, can access everything)
+func ownedBy(ctx context.Context, filter bson.M) (bson.M, error) {
+	user, err := requireUserOrUnscoped(ctx)
 	if err != nil {
-		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("couldn't find tips from MongoDB: %v", err),
-		)
+		return nil, err
+	}
+	if user != "" {
+		filter["owner"] = user
+	}
+	return filter, nil
+}
+
+func findTips(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	cur, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, dbError("couldn't find tips from MongoDB", err)
 	}
 	return cur, nil
 }
@@ -158,6 +307,44 @@ func convertDataToTip(data *tipItem) *protobuf.Tip {
 		Url:         data.URL,
 		Description: data.Description,
 		Image:       data.Image,
+		Pages:       data.Pages,
+		Embed:       convertDataToEmbed(data.Embed),
+		OwnerId:     data.Owner,
+		WorkspaceId: data.WorkspaceID,
+	}
+}
+
+func convertEmbedToData(embed *protobuf.Embed) *embedItem {
+	if embed == nil {
+		return nil
+	}
+	return &embedItem{
+		Type:         embed.GetType(),
+		Title:        embed.GetTitle(),
+		AuthorName:   embed.GetAuthorName(),
+		AuthorURL:    embed.GetAuthorUrl(),
+		ProviderName: embed.GetProviderName(),
+		ThumbnailURL: embed.GetThumbnailUrl(),
+		HTML:         embed.GetHtml(),
+		Width:        embed.GetWidth(),
+		Height:       embed.GetHeight(),
+	}
+}
+
+func convertDataToEmbed(data *embedItem) *protobuf.Embed {
+	if data == nil {
+		return nil
+	}
+	return &protobuf.Embed{
+		Type:         data.Type,
+		Title:        data.Title,
+		AuthorName:   data.AuthorName,
+		AuthorUrl:    data.AuthorURL,
+		ProviderName: data.ProviderName,
+		ThumbnailUrl: data.ThumbnailURL,
+		Html:         data.HTML,
+		Width:        data.Width,
+		Height:       data.Height,
 	}
 }
 
@@ -168,19 +355,52 @@ type tipItem struct {
 	URL         string             `bson:"url"`
 	Description string             `bson:"description"`
 	Image       string             `bson:"image"`
+	Pages       int32              `bson:"pages,omitempty"`
+	Embed       *embedItem         `bson:"embed,omitempty"`
+	Owner       string             `bson:"owner,omitempty"`        // user id (blank for the tips created before user accounts)
+	WorkspaceID string             `bson:"workspace_id,omitempty"` // hex id (blank for the tips created before workspaces)
+}
+
+// embedItem : oEmbed of a tip (html is stored as returned by the provider)
+type embedItem struct {
+	Type         string `bson:"type"`
+	Title        string `bson:"title,omitempty"`
+	AuthorName   string `bson:"author_name,omitempty"`
+	AuthorURL    string `bson:"author_url,omitempty"`
+	ProviderName string `bson:"provider_name,omitempty"`
+	ThumbnailURL string `bson:"thumbnail_url,omitempty"`
+	HTML         string `bson:"html,omitempty"`
+	Width        int32  `bson:"width,omitempty"`
+	Height       int32  `bson:"height,omitempty"`
 }
 
 var collection *mongo.Collection // will be used in many functions. (not only main func!)
+var db *dbManager
 
 type server struct {
 	protobuf.UnimplementedTipServiceServer // must be contained!
+	conf                                   *utils.Store
 }
 
 func main() {
 	// Getting the file name & line number if we crashed the go codes
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	conf := utils.LoadConf("app/utils/config.ini")
+	healthcheck := flag.Bool("healthcheck", false, "check the health of the running server and exit")
+	flag.Parse()
+
+	conf, confErr := utils.Setup() // defaults < config.ini < $TIPSTOCKS_* < --set flags
+	if confErr != nil {
+		log.Fatalf("invalid configuration:\n\t%v", confErr)
+	}
+	if *healthcheck {
+		if err := healthCheck(conf); err != nil {
+			log.Fatalln("unhealthy: ", err)
+		}
+		return
+	}
+	store := utils.NewStore(conf) // hot-reloadable settings
+	utils.SetLogLevel(conf.LogLevel)
 	address := fmt.Sprintf("0.0.0.0:%v", conf.ServerPort)
 	lis, lisErr := net.Listen("tcp", address)
 	if lisErr != nil {
@@ -190,60 +410,78 @@ func main() {
 	// defer fmt.Println("Listener closed.")
 	defer lis.Close()
 
-	opts := []grpc.ServerOption{} // blank options
-	if !conf.ServerDebug {
-		certFile := "app/ssl/server.crt"
-		keyFile := "app/ssl/server.pem"
-		creds, sslErr := credentials.NewServerTLSFromFile(certFile, keyFile)
+	auth := newAuthenticator(conf) // bearer tokens ([auth] section & personal access tokens)
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(auth.unary),
+		grpc.StreamInterceptor(auth.stream),
+	}
+	// [tls] section (a client certificate is required with client_auth = true)
+	if conf.TLSEnabled && conf.TLSAuto {
+		created, certErr := conf.EnsureCerts()
+		if certErr != nil {
+			log.Fatalln("failed to generate certificates: ", certErr)
+			return
+		}
+		if created {
+			log.Printf("Generated development certificates for %v (%v)\n", conf.TLSHosts, conf.TLSCert)
+		}
+	}
+	if conf.TLSEnabled {
+		tlsConf, sslErr := conf.ServerTLSConfig()
 		if sslErr != nil {
 			log.Fatalln("failed to load certificates: ", sslErr)
 			return
 		}
-		opts = append(opts, grpc.Creds(creds))
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
 	}
 	s := grpc.NewServer(opts...)
-	// defer fmt.Println("Server stopped.")
-	defer s.Stop()
 
-	protobuf.RegisterTipServiceServer(s, &server{})
-	reflection.Register(s) // for Evans (https://github.com/ktr0731/evans)
+	srv := &server{conf: store}
+	protobuf.RegisterTipServiceServer(s, srv)
+	protobuf.RegisterTokenServiceServer(s, &tokenServer{srv: srv})
+	protobuf.RegisterUserServiceServer(s, &userServer{srv: srv})
+	protobuf.RegisterWorkspaceServiceServer(s, &workspaceServer{srv: srv})
+	hs := health.NewServer() // grpc.health.v1.Health: SERVING while MongoDB is reachable
+	setServingStatus(hs, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+	if conf.ServerDebug {
+		reflection.Register(s) // for Evans (https://github.com/ktr0731/evans)
+	}
 	// fmt.Println("Ready for running server...")
 
-	// Connect to MongoDB: need to be started DB before running server
-	dbURI := fmt.Sprintf("mongodb://mongodb:%v", conf.DBPort)
-	client, dbErr := mongo.NewClient(options.Client().ApplyURI(dbURI))
+	// Connect to MongoDB: the server keeps retrying until MongoDB gets reachable (NOT_SERVING meanwhile)
+	var dbErr error
+	db, dbErr = newDBManager(conf.DBURI, func(connected bool) {
+		if connected {
+			ensureIndexes()
+			setServingStatus(hs, healthpb.HealthCheckResponse_SERVING)
+		} else {
+			setServingStatus(hs, healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+	})
 	if dbErr != nil {
 		log.Fatalln(dbErr)
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	deadline := 60
-	for {
-		if deadline <= 0 {
-			log.Fatalln("couldn't reach to mongoDB")
-			return
-		}
-		deadline--
-		dbErr = client.Connect(ctx)
-		if dbErr != nil {
-			// log.Println(dbErr)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		pingErr := client.Ping(ctx, readpref.Primary()) // ping to MongoDB
-		if pingErr != nil {
-			// log.Println("ping error to MongoDB: ", pingErr)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-		break
-	}
-	// defer fmt.Println("\nDisconnected with MongoDB.")
-	defer client.Disconnect(ctx) // need to be stopped DB after stopping app
-
-	collection = client.Database(conf.DBName).Collection(conf.DBCollection)
-	fmt.Printf("Connected with MongoDB! (Collection: %v, port: %v)\n", collection.Name(), conf.DBPort)
+	collection = db.client.Database(conf.DBName).Collection(conf.DBCollection)
+	tokenCollection = db.client.Database(conf.DBName).Collection(conf.DBTokenCollection)
+	userCollection = db.client.Database(conf.DBName).Collection(conf.DBUserCollection)
+	workspaceCollection = db.client.Database(conf.DBName).Collection(conf.DBWorkspaceCollection)
+	var workers sync.WaitGroup // background workers to be flushed before disconnecting MongoDB
+	workerCtx, workerCancel := context.WithCancel(context.Background())
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		db.Run(workerCtx, healthCheckInterval)
+	}()
+	// reload settings on SIGHUP & changes of config.ini
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		store.Watch(workerCtx, func(conf utils.Configs) {
+			utils.SetLogLevel(conf.LogLevel)
+		})
+	}()
 
 	// running server as goroutine
 	go func() {
@@ -252,8 +490,59 @@ func main() {
 			log.Fatalln("failed to serve: ", err)
 		}
 	}()
-	// wait for "Control + C" to exit
+	// running HTTP/JSON gateway & gRPC-Web as goroutine
+	gwCtx, gwCancel := context.WithCancel(context.Background())
+	defer gwCancel()
+	gw, gwErr := newGateway(gwCtx, conf)
+	if gwErr != nil {
+		log.Fatalln("failed to create gateway: ", gwErr)
+		return
+	}
+	gw.Handler = withGRPCWeb(newGRPCWeb(s, conf), gw.Handler) // gRPC-Web for browsers
+	go func() {
+		fmt.Printf("HTTP/JSON gateway & gRPC-Web started! (port: %v)\n", conf.GatewayPort)
+		if err := gw.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("failed to serve gateway: ", err)
+		}
+	}()
+	// wait for "Control + C" or SIGTERM (docker stop) to exit
 	interruptCh := make(chan os.Signal, 1)
-	signal.Notify(interruptCh, os.Interrupt)
-	<-interruptCh // block until receiving an interrupt signal
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-interruptCh // block until receiving a signal
+	conf = store.Get()
+	fmt.Printf("\n%v received: draining connections... (deadline: %v)\n", sig, conf.ServerDrainTimeout)
+
+	// graceful shutdown: from the front (HTTP) to the back (MongoDB)
+	hs.Shutdown() // NOT_SERVING: stop receiving new requests from load balancers
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ServerDrainTimeout)
+	defer cancel()
+	if err := gw.Shutdown(ctx); err != nil {
+		log.Println("failed to drain gateway connections: ", err)
+	}
+	gwCancel()
+	gracefulStop(ctx, s)
+	workerCancel()
+	workers.Wait()
+	dbCtx, dbCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer dbCancel()
+	if err := db.Disconnect(dbCtx); err != nil { // need to be stopped DB after stopping app
+		log.Println("failed to disconnect MongoDB: ", err)
+	}
+	fmt.Println("Server stopped.")
+}
+
+// gracefulStop : wait for in-flight RPCs until ctx is done, then cancel the rest of them
+func gracefulStop(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("drain deadline exceeded: stopping in-flight RPCs")
+		s.Stop()
+		<-stopped
+	}
 }
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const tokenPrefix = "tst_" // marks the secrets of tipstocks (e.g. for secret scanners)
+
+var tokenCollection *mongo.Collection
+
+type tokenServer struct {
+	protobuf.UnimplementedTokenServiceServer // must be contained!
+	srv                                      *server
+}
+
+// item struct of personal access tokens for mongoDB (only the hash of the secret is stored)
+type tokenItem struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Name       string             `bson:"name"`
+	Hash       string             `bson:"hash"`
+	Prefix     string             `bson:"prefix"`
+	Scopes     []string           `bson:"scopes"`
+	CreatedAt  int64              `bson:"created_at"`
+	LastUsedAt int64              `bson:"last_used_at"`
+	Owner      string             `bson:"owner,omitempty"` // user id of the creator
+}
+
+func (ts *tokenServer) CreateToken(ctx context.Context, req *protobuf.CreateTokenRequest) (*protobuf.CreateTokenResponse, error) {
+	utils.Debugln("CreateToken requested!")
+	if err := checkTokenRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ts.srv.withTimeout(ctx)
+	defer cancel()
+	secret, err := newSecret()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate a token: %v", err)
+	}
+	data := tokenItem{
+		Name:      req.GetName(),
+		Hash:      hashToken(secret),
+		Prefix:    secret[:len(tokenPrefix)+6],
+		Scopes:    req.GetScopes(),
+		CreatedAt: time.Now().Unix(),
+		Owner:     userOf(ctx), // the token acts on behalf of its creator
+	}
+	res, err := tokenCollection.InsertOne(ctx, data)
+	if err != nil {
+		return nil, dbError("couldn't create a token in MongoDB", err)
+	}
+	objID, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "InsertedID cannot be converted to objID")
+	}
+	data.ID = objID
+	return &protobuf.CreateTokenResponse{Token: convertDataToToken(&data), Secret: secret}, nil
+}
+
+func (ts *tokenServer) ListTokens(ctx context.Context, req *protobuf.ListTokensRequest) (*protobuf.ListTokensResponse, error) {
+	utils.Debugln("ListTokens requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ts.srv.withTimeout(ctx)
+	defer cancel()
+	filter, err := ownedBy(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"hash": 0})
+	cur, err := tokenCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, dbError("couldn't find tokens from MongoDB", err)
+	}
+	defer closeCursor(cur)
+	tokens := []*protobuf.Token{}
+	for cur.Next(ctx) {
+		data := &tokenItem{}
+		if err := cur.Decode(data); err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot decode data from MongoDB: %v", err)
+		}
+		tokens = append(tokens, convertDataToToken(data))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, dbError("couldn't list tokens from MongoDB", err)
+	}
+	return &protobuf.ListTokensResponse{Tokens: tokens}, nil
+}
+
+func (ts *tokenServer) RevokeToken(ctx context.Context, req *protobuf.RevokeTokenRequest) (*protobuf.RevokeTokenResponse, error) {
+	utils.Debugln("RevokeToken requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ts.srv.withTimeout(ctx)
+	defer cancel()
+	tokenID := req.GetTokenId()
+	objID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse id: %v", err)
+	}
+	filter, err := ownedBy(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return nil, err
+	}
+	res, err := tokenCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		return nil, dbError("couldn't revoke a token in MongoDB", err)
+	} else if res.DeletedCount == 0 {
+		return nil, status.Errorf(codes.NotFound, "cannot find a token with id: %v", tokenID)
+	}
+	return &protobuf.RevokeTokenResponse{TokenId: tokenID}, nil
+}
+
+// checkTokenRequest : a token acts on behalf of a user, with some of the scopes of its creator
+// (a token with tokens:admin only cannot create a token with tips:write)
+func checkTokenRequest(ctx context.Context, req *protobuf.CreateTokenRequest) error {
+	if req.GetName() == "" {
+		return status.Errorf(codes.InvalidArgument, "name is required")
+	}
+	if len(req.GetScopes()) == 0 {
+		return status.Errorf(codes.InvalidArgument, "at least one scope is required: %v", tokenScopes)
+	}
+	caller := callerOf(ctx)
+	for _, scope := range req.GetScopes() {
+		if !containsScope(tokenScopes, scope) {
+			return status.Errorf(codes.InvalidArgument, "unknown scope %q: %v", scope, tokenScopes)
+		}
+		if caller != nil && !caller.hasScope(scope) {
+			return status.Errorf(codes.PermissionDenied, "token %q cannot grant the scope %v it doesn't have", caller.Name, scope)
+		}
+	}
+	// without an owner, the token would see the tips of every user & workspace
+	if userOf(ctx) == "" {
+		return status.Errorf(codes.FailedPrecondition, "tokens are created on behalf of a user (forward %v with the service token)", utils.UserMetadataKey)
+	}
+	return nil
+}
+
+// newSecret : tst_ + 256-bit random value
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func convertDataToToken(data *tokenItem) *protobuf.Token {
+	return &protobuf.Token{
+		Id:         data.ID.Hex(),
+		Name:       data.Name,
+		Scopes:     data.Scopes,
+		Prefix:     data.Prefix,
+		CreatedAt:  data.CreatedAt,
+		LastUsedAt: data.LastUsedAt,
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// useMock : the collections answer with the mock responses of mt
+func useMock(mt *mtest.T) *server {
+	db = &dbManager{connected: 1}
+	collection, tokenCollection, userCollection, workspaceCollection = mt.Coll, mt.Coll, mt.Coll, mt.Coll
+	return &server{conf: utils.NewStore(utils.Configs{ServerMaxTimeout: 5 * time.Second})}
+}
+
+func asCaller(p *principal) context.Context {
+	return context.WithValue(context.Background(), principalKey{}, p)
+}
+
+// TestCreateTokenScopes : tokens only grant the scopes of their creator, on behalf of a user
+func TestCreateTokenScopes(t *testing.T) {
+	ts := &tokenServer{srv: &server{conf: utils.NewStore(utils.Configs{ServerMaxTimeout: time.Second})}}
+	admin := &principal{TokenID: "1", Name: "admin only", Scopes: []string{scopeTokensAdmin, scopeTipsRead}, UserID: "alice"}
+	service := &principal{Name: "service", Scopes: allScopes}
+	cases := []struct {
+		caller *principal
+		scopes []string
+		want   codes.Code
+	}{
+		{admin, []string{scopeTipsWrite}, codes.PermissionDenied}, // privilege escalation
+		{admin, []string{scopeTipsRead, scopeTokensAdmin, scopeTipsWrite}, codes.PermissionDenied},
+		{admin, []string{scopeUsersAuth}, codes.InvalidArgument}, // only for the service token
+		{admin, []string{"tips:*"}, codes.InvalidArgument},
+		{admin, nil, codes.InvalidArgument},
+		{service, []string{scopeTipsRead}, codes.FailedPrecondition}, // no owner: would see every tip
+		{nil, []string{scopeTipsRead}, codes.FailedPrecondition},     // [auth] enabled = false
+	}
+	for _, c := range cases {
+		ctx := context.Background()
+		if c.caller != nil {
+			ctx = asCaller(c.caller)
+		}
+		_, err := ts.CreateToken(ctx, &protobuf.CreateTokenRequest{Name: "cli", Scopes: c.scopes})
+		if status.Code(err) != c.want {
+			t.Errorf("%v %v: %v (want %v)", c.caller, c.scopes, err, c.want)
+		}
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("owner", func(mt *mtest.T) {
+		ts := &tokenServer{srv: useMock(mt)}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		service := &principal{Name: "service", Scopes: allScopes, UserID: "bob"}
+		res, err := ts.CreateToken(asCaller(service), &protobuf.CreateTokenRequest{Name: "cli", Scopes: []string{scopeTipsRead}})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if doc.Lookup("owner").StringValue() != "bob" || doc.Lookup("hash").StringValue() != hashToken(res.GetSecret()) {
+			mt.Errorf("unexpected token stored: %v", doc)
+		}
+	})
+}
+
+// TestLookupServiceToken : the service token acts on behalf of a non-blank user, or explicitly on every user
+func TestLookupServiceToken(t *testing.T) {
+	a := newAuthenticator(utils.Configs{AuthEnabled: true, AuthServiceToken: "service"})
+	cases := []struct {
+		md       metadata.MD
+		user     string
+		unscoped bool
+		want     codes.Code
+	}{
+		{metadata.Pairs(utils.UserMetadataKey, "alice"), "alice", false, codes.OK},
+		{metadata.Pairs(utils.UserMetadataKey, ""), "", false, codes.Unauthenticated},
+		{metadata.Pairs(utils.UserMetadataKey, "", utils.UnscopedMetadataKey, "true"), "", false, codes.Unauthenticated},
+		{metadata.Pairs(utils.UnscopedMetadataKey, "true"), "", true, codes.OK},
+		{metadata.MD{}, "", false, codes.OK}, // e.g. Login, but TipService rejects it
+	}
+	for _, c := range cases {
+		p, err := a.lookup(metadata.NewIncomingContext(context.Background(), c.md), "service")
+		if status.Code(err) != c.want || err == nil && (p.UserID != c.user || p.Unscoped != c.unscoped) {
+			t.Errorf("%v: %+v %v (want %v)", c.md, p, err, c.want)
+		}
+	}
+}
+
+// TestLookupOwnerlessToken : tokens created without an owner are rejected
+func TestLookupOwnerlessToken(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	a := &authenticator{enabled: true}
+	token := func(owner string) bson.D {
+		return bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "name", Value: "cli"}, {Key: "scopes", Value: bson.A{scopeTipsRead}}, {Key: "owner", Value: owner}}
+	}
+	mt.Run("without owner", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: token("")}))
+		if _, err := a.lookup(context.Background(), "tst_x"); status.Code(err) != codes.PermissionDenied {
+			mt.Errorf("ownerless token is accepted: %v", err)
+		}
+	})
+	mt.Run("with owner", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: token("alice")}))
+		p, err := a.lookup(context.Background(), "tst_x")
+		if err != nil || p.UserID != "alice" {
+			mt.Errorf("unexpected principal %+v: %v", p, err)
+		}
+	})
+}
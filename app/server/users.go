@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores the rest
+	maxUsernameSuffix = 20 // username-2 ... username-20 for the users of OpenID Connect
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,32}$`)
+
+// dummyHash : compared for unknown users, so that the response time doesn't tell whether a user exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("tipstocks"), bcrypt.DefaultCost)
+
+var userCollection *mongo.Collection
+
+type userServer struct {
+	protobuf.UnimplementedUserServiceServer // must be contained!
+	srv                                     *server
+}
+
+// item struct of local accounts for mongoDB (bcrypt hash of the password)
+type userItem struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Username     string             `bson:"username"`
+	PasswordHash []byte             `bson:"password_hash,omitempty"` // blank for the users of OpenID Connect
+	Issuer       string             `bson:"issuer,omitempty"`        // OpenID Connect
+	Subject      string             `bson:"subject,omitempty"`
+	Email        string             `bson:"email,omitempty"`
+	CreatedAt    int64              `bson:"created_at"`
+}
+
+func (us *userServer) Signup(ctx context.Context, req *protobuf.SignupRequest) (*protobuf.SignupResponse, error) {
+	utils.Debugln("Signup requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := us.srv.withTimeout(ctx)
+	defer cancel()
+	if !usernamePattern.MatchString(req.GetUsername()) {
+		return nil, status.Errorf(codes.InvalidArgument, "username must be 3-32 characters of letters, digits, _ . -")
+	}
+	if n := len(req.GetPassword()); n < minPasswordLength || n > maxPasswordLength {
+		return nil, status.Errorf(codes.InvalidArgument, "password must be %v-%v bytes", minPasswordLength, maxPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.GetPassword()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot hash the password: %v", err)
+	}
+	data := userItem{
+		Username:     req.GetUsername(),
+		PasswordHash: hash,
+		CreatedAt:    time.Now().Unix(),
+	}
+	res, err := userCollection.InsertOne(ctx, data)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, status.Errorf(codes.AlreadyExists, "username is already taken: %v", req.GetUsername())
+	} else if err != nil {
+		return nil, dbError("couldn't create a user in MongoDB", err)
+	}
+	objID, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "InsertedID cannot be converted to objID")
+	}
+	data.ID = objID
+	return &protobuf.SignupResponse{User: convertDataToUser(&data)}, nil
+}
+
+func (us *userServer) Login(ctx context.Context, req *protobuf.LoginRequest) (*protobuf.LoginResponse, error) {
+	utils.Debugln("Login requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := us.srv.withTimeout(ctx)
+	defer cancel()
+	data := &userItem{}
+	err := userCollection.FindOne(ctx, bson.M{"username": req.GetUsername()}).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(req.GetPassword()))
+		return nil, status.Errorf(codes.Unauthenticated, "invalid username or password")
+	} else if err != nil {
+		return nil, dbError("couldn't find a user in MongoDB", err)
+	}
+	if len(data.PasswordHash) == 0 || bcrypt.CompareHashAndPassword(data.PasswordHash, []byte(req.GetPassword())) != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid username or password")
+	}
+	return &protobuf.LoginResponse{User: convertDataToUser(data)}, nil
+}
+
+// ExternalLogin : the user of the OpenID Connect identity (issuer & subject), created on the first login
+func (us *userServer) ExternalLogin(ctx context.Context, req *protobuf.ExternalLoginRequest) (*protobuf.ExternalLoginResponse, error) {
+	utils.Debugln("ExternalLogin requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := us.srv.withTimeout(ctx)
+	defer cancel()
+	if req.GetIssuer() == "" || req.GetSubject() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "issuer and subject are required")
+	}
+	if !usernamePattern.MatchString(req.GetUsername()) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid username: %v", req.GetUsername())
+	}
+	filter := bson.M{"issuer": req.GetIssuer(), "subject": req.GetSubject()}
+	data := &userItem{}
+	err := userCollection.FindOne(ctx, filter).Decode(data)
+	if err == nil {
+		return &protobuf.ExternalLoginResponse{User: convertDataToUser(data)}, nil
+	} else if err != mongo.ErrNoDocuments {
+		return nil, dbError("couldn't find a user in MongoDB", err)
+	}
+	// first login: take the suggested username, or username-2, username-3... if it's taken
+	data = &userItem{
+		Issuer:    req.GetIssuer(),
+		Subject:   req.GetSubject(),
+		Email:     req.GetEmail(),
+		CreatedAt: time.Now().Unix(),
+	}
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		data.Username = req.GetUsername()
+		if i > 1 {
+			data.Username = fmt.Sprintf("%v-%v", req.GetUsername(), i)
+		}
+		res, err := userCollection.InsertOne(ctx, data)
+		if mongo.IsDuplicateKeyError(err) {
+			// the identity may have been created by a concurrent login
+			if err := userCollection.FindOne(ctx, filter).Decode(data); err == nil {
+				return &protobuf.ExternalLoginResponse{User: convertDataToUser(data)}, nil
+			}
+			continue
+		} else if err != nil {
+			return nil, dbError("couldn't create a user in MongoDB", err)
+		}
+		objID, ok := res.InsertedID.(primitive.ObjectID)
+		if !ok {
+			return nil, status.Errorf(codes.Internal, "InsertedID cannot be converted to objID")
+		}
+		data.ID = objID
+		return &protobuf.ExternalLoginResponse{User: convertDataToUser(data)}, nil
+	}
+	return nil, status.Errorf(codes.AlreadyExists, "username is already taken: %v", req.GetUsername())
+}
+
+func convertDataToUser(data *userItem) *protobuf.User {
+	return &protobuf.User{
+		Id:        data.ID.Hex(),
+		Username:  data.Username,
+		CreatedAt: data.CreatedAt,
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// roles of the members (a role includes the permissions of the lower ones)
+const (
+	roleViewer = "viewer" // read the tips
+	roleEditor = "editor" // + create, update & delete the tips
+	roleOwner  = "owner"  // + invite & remove members
+)
+
+var roleLevels = map[string]int{roleViewer: 1, roleEditor: 2, roleOwner: 3}
+
+const (
+	invitePrefix = "tsi_"
+	inviteTTL    = 7 * 24 * time.Hour
+)
+
+var workspaceCollection *mongo.Collection
+
+type workspaceServer struct {
+	protobuf.UnimplementedWorkspaceServiceServer // must be contained!
+	srv                                          *server
+}
+
+// item structs of workspaces for mongoDB (members & invites are embedded)
+type workspaceItem struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Name       string             `bson:"name"`
+	PersonalOf string             `bson:"personal_of,omitempty"` // user id of the personal workspace
+	Members    []memberItem       `bson:"members"`
+	Invites    []inviteItem       `bson:"invites"`
+	CreatedAt  int64              `bson:"created_at"`
+}
+
+type memberItem struct {
+	UserID string `bson:"user_id"`
+	Role   string `bson:"role"`
+}
+
+type inviteItem struct {
+	Hash      string `bson:"hash"` // SHA-256 of the token
+	Role      string `bson:"role"`
+	CreatedBy string `bson:"created_by"`
+	ExpiresAt int64  `bson:"expires_at"`
+}
+
+func (w *workspaceItem) roleOf(user string) string {
+	for _, m := range w.Members {
+		if m.UserID == user {
+			return m.Role
+		}
+	}
+	return ""
+}
+
+// tipScope : filter of the tips in the workspace of the request, where the caller needs minRole
+// only the unscoped callers (see requireUserOrUnscoped) see every tip
+func tipScope(ctx context.Context, minRole string, filter bson.M) (bson.M, error) {
+	ws, err := currentWorkspace(ctx, minRole)
+	if err != nil {
+		return nil, err
+	}
+	if ws != "" {
+		filter["workspace_id"] = ws
+	}
+	return filter, nil
+}
+
+// currentWorkspace : id of the workspace in utils.WorkspaceMetadataKey (the personal one if missing),
+// PermissionDenied unless the user of the request is a member with minRole
+func currentWorkspace(ctx context.Context, minRole string) (string, error) {
+	user, err := requireUserOrUnscoped(ctx)
+	if err != nil || user == "" {
+		return "", err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	v := md.Get(utils.WorkspaceMetadataKey)
+	var ws *workspaceItem
+	if len(v) == 0 || v[0] == "" {
+		ws, err = personalWorkspace(ctx, user)
+	} else {
+		ws, err = memberOf(ctx, v[0], user)
+	}
+	if err != nil {
+		return "", err
+	}
+	if role := ws.roleOf(user); roleLevels[role] < roleLevels[minRole] {
+		return "", status.Errorf(codes.PermissionDenied, "%v of workspace %q cannot do this (%v required)", role, ws.Name, minRole)
+	}
+	return ws.ID.Hex(), nil
+}
+
+// memberOf : the workspace if user is a member (NotFound otherwise, not to tell which workspaces exist)
+func memberOf(ctx context.Context, workspaceID, user string) (*workspaceItem, error) {
+	objID, err := primitive.ObjectIDFromHex(workspaceID)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot parse workspace id: %v", err)
+	}
+	ws := &workspaceItem{}
+	err = workspaceCollection.FindOne(ctx, bson.M{"_id": objID, "members.user_id": user}).Decode(ws)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(codes.NotFound, "cannot find a workspace with id: %v", workspaceID)
+	} else if err != nil {
+		return nil, dbError("couldn't find a workspace in MongoDB", err)
+	}
+	return ws, nil
+}
+
+// personalWorkspace : the personal workspace of user, created on the first use
+// with the tips the user created before workspaces existed
+func personalWorkspace(ctx context.Context, user string) (*workspaceItem, error) {
+	filter := bson.M{"personal_of": user}
+	update := bson.M{"$setOnInsert": workspaceItem{
+		Name:       "Personal",
+		PersonalOf: user,
+		Members:    []memberItem{{UserID: user, Role: roleOwner}},
+		Invites:    []inviteItem{},
+		CreatedAt:  time.Now().Unix(),
+	}}
+	res, err := workspaceCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return nil, dbError("couldn't create the personal workspace in MongoDB", err)
+	}
+	ws := &workspaceItem{}
+	if err := workspaceCollection.FindOne(ctx, filter).Decode(ws); err != nil {
+		return nil, dbError("couldn't find the personal workspace in MongoDB", err)
+	}
+	if res.UpsertedCount > 0 {
+		_, err := collection.UpdateMany(ctx,
+			bson.M{"owner": user, "workspace_id": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"workspace_id": ws.ID.Hex()}})
+		if err != nil {
+			return nil, dbError("couldn't move the tips to the personal workspace in MongoDB", err)
+		}
+	}
+	return ws, nil
+}
+
+// requireUser : the workspaces are per user
+func requireUser(ctx context.Context) (string, error) {
+	user := userOf(ctx)
+	if user == "" {
+		return "", status.Errorf(codes.FailedPrecondition, "workspaces require a user (sign in to the web client or use a token created by a user)")
+	}
+	return user, nil
+}
+
+func (ws *workspaceServer) ListWorkspaces(ctx context.Context, req *protobuf.ListWorkspacesRequest) (*protobuf.ListWorkspacesResponse, error) {
+	utils.Debugln("ListWorkspaces requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := personalWorkspace(ctx, user); err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"invites": 0})
+	cur, err := workspaceCollection.Find(ctx, bson.M{"members.user_id": user}, opts)
+	if err != nil {
+		return nil, dbError("couldn't find workspaces from MongoDB", err)
+	}
+	defer closeCursor(cur)
+	workspaces := []*protobuf.Workspace{}
+	for cur.Next(ctx) {
+		data := &workspaceItem{}
+		if err := cur.Decode(data); err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot decode data from MongoDB: %v", err)
+		}
+		workspaces = append(workspaces, convertDataToWorkspace(data, user))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, dbError("couldn't list workspaces from MongoDB", err)
+	}
+	return &protobuf.ListWorkspacesResponse{Workspaces: workspaces}, nil
+}
+
+func (ws *workspaceServer) CreateWorkspace(ctx context.Context, req *protobuf.CreateWorkspaceRequest) (*protobuf.CreateWorkspaceResponse, error) {
+	utils.Debugln("CreateWorkspace requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.GetName())
+	if name == "" || len([]rune(name)) > 64 {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be 1-64 characters")
+	}
+	data := workspaceItem{
+		Name:      name,
+		Members:   []memberItem{{UserID: user, Role: roleOwner}},
+		Invites:   []inviteItem{},
+		CreatedAt: time.Now().Unix(),
+	}
+	res, err := workspaceCollection.InsertOne(ctx, data)
+	if err != nil {
+		return nil, dbError("couldn't create a workspace in MongoDB", err)
+	}
+	objID, ok := res.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "InsertedID cannot be converted to objID")
+	}
+	data.ID = objID
+	return &protobuf.CreateWorkspaceResponse{Workspace: convertDataToWorkspace(&data, user)}, nil
+}
+
+func (ws *workspaceServer) ListMembers(ctx context.Context, req *protobuf.ListMembersRequest) (*protobuf.ListMembersResponse, error) {
+	utils.Debugln("ListMembers requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := memberOf(ctx, req.GetWorkspaceId(), user)
+	if err != nil {
+		return nil, err
+	}
+	// usernames of the members
+	ids := []primitive.ObjectID{}
+	for _, m := range data.Members {
+		if id, err := primitive.ObjectIDFromHex(m.UserID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	usernames := map[string]string{}
+	cur, err := userCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"username": 1}))
+	if err != nil {
+		return nil, dbError("couldn't find users from MongoDB", err)
+	}
+	defer closeCursor(cur)
+	for cur.Next(ctx) {
+		u := &userItem{}
+		if err := cur.Decode(u); err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot decode data from MongoDB: %v", err)
+		}
+		usernames[u.ID.Hex()] = u.Username
+	}
+	if err := cur.Err(); err != nil {
+		return nil, dbError("couldn't list users from MongoDB", err)
+	}
+	members := []*protobuf.Member{}
+	for _, m := range data.Members {
+		members = append(members, &protobuf.Member{UserId: m.UserID, Username: usernames[m.UserID], Role: m.Role})
+	}
+	return &protobuf.ListMembersResponse{Members: members}, nil
+}
+
+func (ws *workspaceServer) RemoveMember(ctx context.Context, req *protobuf.RemoveMemberRequest) (*protobuf.RemoveMemberResponse, error) {
+	utils.Debugln("RemoveMember requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := memberOf(ctx, req.GetWorkspaceId(), user)
+	if err != nil {
+		return nil, err
+	}
+	target := req.GetUserId()
+	if target != user && data.roleOf(user) != roleOwner {
+		return nil, status.Errorf(codes.PermissionDenied, "only owners can remove other members")
+	}
+	if data.roleOf(target) == "" {
+		return nil, status.Errorf(codes.NotFound, "cannot find a member with id: %v", target)
+	}
+	if data.PersonalOf == target {
+		return nil, status.Errorf(codes.FailedPrecondition, "the owner of a personal workspace cannot be removed")
+	}
+	// keep at least one owner: the update only matches while another owner remains
+	filter := bson.M{"_id": data.ID, "members.user_id": target}
+	if data.roleOf(target) == roleOwner {
+		filter["members"] = bson.M{"$elemMatch": bson.M{"role": roleOwner, "user_id": bson.M{"$ne": target}}}
+	}
+	res, err := workspaceCollection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"members": bson.M{"user_id": target}}})
+	if err != nil {
+		return nil, dbError("couldn't remove a member in MongoDB", err)
+	} else if res.ModifiedCount == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "a workspace needs at least one owner")
+	}
+	return &protobuf.RemoveMemberResponse{UserId: target}, nil
+}
+
+func (ws *workspaceServer) CreateInvite(ctx context.Context, req *protobuf.CreateInviteRequest) (*protobuf.CreateInviteResponse, error) {
+	utils.Debugln("CreateInvite requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := roleLevels[req.GetRole()]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "role must be %v, %v or %v: %q", roleOwner, roleEditor, roleViewer, req.GetRole())
+	}
+	data, err := memberOf(ctx, req.GetWorkspaceId(), user)
+	if err != nil {
+		return nil, err
+	}
+	if data.roleOf(user) != roleOwner {
+		return nil, status.Errorf(codes.PermissionDenied, "only owners can invite members")
+	}
+	token, err := newSecret()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot generate an invite: %v", err)
+	}
+	token = invitePrefix + strings.TrimPrefix(token, tokenPrefix)
+	now := time.Now()
+	invite := inviteItem{
+		Hash:      hashToken(token),
+		Role:      req.GetRole(),
+		CreatedBy: user,
+		ExpiresAt: now.Add(inviteTTL).Unix(),
+	}
+	// drop the expired invites first ($pull & $push of the same field cannot be in one update)
+	expired := bson.M{"$pull": bson.M{"invites": bson.M{"expires_at": bson.M{"$lt": now.Unix()}}}}
+	if _, err := workspaceCollection.UpdateOne(ctx, bson.M{"_id": data.ID}, expired); err != nil {
+		return nil, dbError("couldn't drop the expired invites in MongoDB", err)
+	}
+	if _, err := workspaceCollection.UpdateOne(ctx, bson.M{"_id": data.ID}, bson.M{"$push": bson.M{"invites": invite}}); err != nil {
+		return nil, dbError("couldn't create an invite in MongoDB", err)
+	}
+	return &protobuf.CreateInviteResponse{Token: token, ExpiresAt: invite.ExpiresAt}, nil
+}
+
+func (ws *workspaceServer) AcceptInvite(ctx context.Context, req *protobuf.AcceptInviteRequest) (*protobuf.AcceptInviteResponse, error) {
+	utils.Debugln("AcceptInvite requested!")
+	if err := checkDB(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := ws.srv.withTimeout(ctx)
+	defer cancel()
+	user, err := requireUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hash := hashToken(req.GetToken())
+	data := &workspaceItem{}
+	valid := bson.M{"$elemMatch": bson.M{"hash": hash, "expires_at": bson.M{"$gte": time.Now().Unix()}}}
+	err = workspaceCollection.FindOne(ctx, bson.M{"invites": valid}).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Errorf(codes.NotFound, "invalid or expired invite")
+	} else if err != nil {
+		return nil, dbError("couldn't find an invite in MongoDB", err)
+	}
+	if data.roleOf(user) == "" { // members keep their role (and the invite)
+		var invite inviteItem
+		for _, inv := range data.Invites {
+			if inv.Hash == hash {
+				invite = inv
+			}
+		}
+		// the role given is capped by the current role of the member who invited: invites of the removed members are void
+		creatorRole := data.roleOf(invite.CreatedBy)
+		if creatorRole == "" {
+			return nil, status.Errorf(codes.NotFound, "invalid or expired invite")
+		}
+		role := invite.Role
+		if roleLevels[role] > roleLevels[creatorRole] {
+			role = creatorRole
+		}
+		// invites are single-use: the update only matches while the invite is valid, and consumes it
+		member := memberItem{UserID: user, Role: role}
+		res, err := workspaceCollection.UpdateOne(ctx,
+			bson.M{"_id": data.ID, "members.user_id": bson.M{"$ne": user}, "invites": valid},
+			bson.M{"$pull": bson.M{"invites": bson.M{"hash": hash}}, "$push": bson.M{"members": member}})
+		if err != nil {
+			return nil, dbError("couldn't add a member in MongoDB", err)
+		} else if res.ModifiedCount == 0 {
+			return nil, status.Errorf(codes.NotFound, "invalid or expired invite")
+		}
+		data.Members = append(data.Members, member)
+	}
+	return &protobuf.AcceptInviteResponse{Workspace: convertDataToWorkspace(data, user)}, nil
+}
+
+func convertDataToWorkspace(data *workspaceItem, user string) *protobuf.Workspace {
+	return &protobuf.Workspace{
+		Id:        data.ID.Hex(),
+		Name:      data.Name,
+		Role:      data.roleOf(user),
+		Personal:  data.PersonalOf != "",
+		CreatedAt: data.CreatedAt,
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"myTips/tipstocks/app/protobuf"
+	"myTips/tipstocks/app/utils"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// asMember : context of user calling with the workspace metadata (the personal workspace if blank)
+func asMember(user, workspaceID string) context.Context {
+	ctx := asCaller(&principal{Name: "service", Scopes: allScopes, UserID: user})
+	if workspaceID == "" {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(utils.WorkspaceMetadataKey, workspaceID))
+}
+
+// workspaceDoc : workspace document with the members as user id & role pairs
+func workspaceDoc(id primitive.ObjectID, personalOf string, members ...string) bson.D {
+	list := bson.A{}
+	for i := 0; i+1 < len(members); i += 2 {
+		list = append(list, bson.D{{Key: "user_id", Value: members[i]}, {Key: "role", Value: members[i+1]}})
+	}
+	return bson.D{{Key: "_id", Value: id}, {Key: "name", Value: "team"}, {Key: "personal_of", Value: personalOf}, {Key: "members", Value: list}}
+}
+
+// found : response of FindOne (no documents without doc)
+func found(doc ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "tipstocks.workspaces", mtest.FirstBatch, doc...)
+}
+
+func updated(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// sentFilter : filter of the next command sent to the mock (find or update)
+func sentFilter(mt *mtest.T) bson.Raw {
+	cmd := mt.GetStartedEvent().Command
+	if filter, ok := cmd.Lookup("filter").DocumentOK(); ok {
+		return filter
+	}
+	return cmd.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+}
+
+// TestTipScope : tips are scoped to a workspace of which the user is a member with the role required
+func TestTipScope(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	team, personal := primitive.NewObjectID(), primitive.NewObjectID()
+
+	mt.Run("member", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(found(workspaceDoc(team, "", "alice", roleOwner, "bob", roleViewer)))
+		filter, err := tipScope(asMember("alice", team.Hex()), roleEditor, bson.M{})
+		if err != nil || filter["workspace_id"] != team.Hex() {
+			mt.Fatalf("unexpected filter %v: %v", filter, err)
+		}
+		if sent := sentFilter(mt); sent.Lookup("members.user_id").StringValue() != "alice" || sent.Lookup("_id").ObjectID() != team {
+			mt.Errorf("membership is not checked: %v", sent)
+		}
+	})
+	mt.Run("other workspace", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(found()) // carol is not a member
+		if _, err := tipScope(asMember("carol", team.Hex()), roleViewer, bson.M{}); status.Code(err) != codes.NotFound {
+			mt.Errorf("tips of another workspace: %v", err)
+		}
+	})
+	mt.Run("roles", func(mt *mtest.T) {
+		useMock(mt)
+		cases := []struct {
+			user, minRole string
+			want          codes.Code
+		}{
+			{"bob", roleViewer, codes.OK},
+			{"bob", roleEditor, codes.PermissionDenied},
+			{"dave", roleEditor, codes.OK},
+			{"dave", roleOwner, codes.PermissionDenied},
+			{"alice", roleOwner, codes.OK},
+		}
+		for _, c := range cases {
+			mt.AddMockResponses(found(workspaceDoc(team, "", "alice", roleOwner, "bob", roleViewer, "dave", roleEditor)))
+			if _, err := currentWorkspace(asMember(c.user, team.Hex()), c.minRole); status.Code(err) != c.want {
+				mt.Errorf("%v as %v: %v (want %v)", c.user, c.minRole, err, c.want)
+			}
+		}
+	})
+	mt.Run("personal", func(mt *mtest.T) {
+		useMock(mt)
+		mt.AddMockResponses(updated(1), found(workspaceDoc(personal, "alice", "alice", roleOwner)))
+		if filter, err := tipScope(asMember("alice", ""), roleEditor, bson.M{}); err != nil || filter["workspace_id"] != personal.Hex() {
+			mt.Errorf("unexpected filter %v: %v", filter, err)
+		}
+	})
+	mt.Run("without user", func(mt *mtest.T) {
+		useMock(mt)
+		unscoped := asCaller(&principal{Name: "service", Scopes: allScopes, Unscoped: true})
+		for _, ctx := range []context.Context{context.Background(), unscoped} { // [auth] enabled = false & administration
+			if filter, err := tipScope(ctx, roleEditor, bson.M{"_id": team}); err != nil || len(filter) != 1 {
+				mt.Errorf("unexpected filter %v: %v", filter, err)
+			}
+		}
+		service := asCaller(&principal{Name: "service", Scopes: allScopes})
+		if filter, err := tipScope(service, roleViewer, bson.M{}); status.Code(err) != codes.Unauthenticated {
+			mt.Errorf("every tip without a user: %v %v", filter, err)
+		}
+	})
+}
+
+// TestRemoveMember : only owners remove the others, and a workspace keeps at least one owner
+func TestRemoveMember(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	team := primitive.NewObjectID()
+	doc := workspaceDoc(team, "", "alice", roleOwner, "bob", roleEditor, "carol", roleViewer)
+	remove := func(ws *workspaceServer, user, target string) error {
+		_, err := ws.RemoveMember(asMember(user, ""), &protobuf.RemoveMemberRequest{WorkspaceId: team.Hex(), UserId: target})
+		return err
+	}
+
+	mt.Run("by owner", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(doc), updated(1))
+		if err := remove(ws, "alice", "bob"); err != nil {
+			mt.Error(err)
+		}
+	})
+	mt.Run("by editor", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(doc))
+		if err := remove(ws, "bob", "carol"); status.Code(err) != codes.PermissionDenied {
+			mt.Errorf("editor removed a member: %v", err)
+		}
+	})
+	mt.Run("leave", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(doc), updated(1))
+		if err := remove(ws, "carol", "carol"); err != nil {
+			mt.Error(err)
+		}
+	})
+	mt.Run("last owner", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(doc), updated(0)) // no other owner matches
+		if err := remove(ws, "alice", "alice"); status.Code(err) != codes.FailedPrecondition {
+			mt.Errorf("last owner removed: %v", err)
+		}
+		sentFilter(mt) // memberOf
+		other := sentFilter(mt).Lookup("members", "$elemMatch")
+		if other.Document().Lookup("role").StringValue() != roleOwner || other.Document().Lookup("user_id", "$ne").StringValue() != "alice" {
+			mt.Errorf("another owner is not required: %v", other)
+		}
+	})
+	mt.Run("personal owner", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(workspaceDoc(team, "alice", "alice", roleOwner, "bob", roleOwner)))
+		if err := remove(ws, "bob", "alice"); status.Code(err) != codes.FailedPrecondition {
+			mt.Errorf("owner of a personal workspace removed: %v", err)
+		}
+	})
+}
+
+// TestAcceptInvite : unknown, expired & used invites are rejected, the others add the user once with their role (at most the inviter's)
+func TestAcceptInvite(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	team := primitive.NewObjectID()
+
+	mt.Run("unknown or expired", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found())
+		_, err := ws.AcceptInvite(asMember("carol", ""), &protobuf.AcceptInviteRequest{Token: "tsi_x"})
+		if status.Code(err) != codes.NotFound {
+			mt.Errorf("invite accepted: %v", err)
+		}
+		invite := sentFilter(mt).Lookup("invites", "$elemMatch").Document()
+		if invite.Lookup("hash").StringValue() != hashToken("tsi_x") || invite.Lookup("expires_at", "$gte").Int64() < time.Now().Add(-time.Minute).Unix() {
+			mt.Errorf("expired invites are not excluded: %v", invite)
+		}
+	})
+	// invite of alice for role (with the members as user id & role pairs)
+	invited := func(role string, members ...string) bson.D {
+		return append(workspaceDoc(team, "", members...), bson.E{Key: "invites", Value: bson.A{
+			bson.D{{Key: "hash", Value: hashToken("tsi_x")}, {Key: "role", Value: role}, {Key: "created_by", Value: "alice"}, {Key: "expires_at", Value: time.Now().Add(time.Hour).Unix()}},
+		}})
+	}
+	accept := func(ws *workspaceServer) (*protobuf.AcceptInviteResponse, error) {
+		return ws.AcceptInvite(asMember("carol", ""), &protobuf.AcceptInviteRequest{Token: "tsi_x"})
+	}
+
+	mt.Run("valid", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(invited(roleEditor, "alice", roleOwner)), updated(1))
+		res, err := accept(ws)
+		if err != nil || res.GetWorkspace().GetRole() != roleEditor {
+			mt.Errorf("unexpected workspace %v: %v", res.GetWorkspace(), err)
+		}
+		sentFilter(mt) // find
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if update.Lookup("q", "invites", "$elemMatch", "hash").StringValue() != hashToken("tsi_x") || update.Lookup("u", "$pull", "invites", "hash").StringValue() != hashToken("tsi_x") {
+			mt.Errorf("invite is not consumed: %v", update)
+		}
+	})
+	mt.Run("used", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(invited(roleEditor, "alice", roleOwner)), updated(0)) // accepted meanwhile
+		if _, err := accept(ws); status.Code(err) != codes.NotFound {
+			mt.Errorf("invite accepted twice: %v", err)
+		}
+	})
+	mt.Run("capped role", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(invited(roleOwner, "alice", roleViewer, "bob", roleOwner)), updated(1)) // alice was demoted
+		if res, err := accept(ws); err != nil || res.GetWorkspace().GetRole() != roleViewer {
+			mt.Errorf("role above the inviter's: %v %v", res.GetWorkspace(), err)
+		}
+	})
+	mt.Run("inviter removed", func(mt *mtest.T) {
+		ws := &workspaceServer{srv: useMock(mt)}
+		mt.AddMockResponses(found(invited(roleEditor, "bob", roleOwner)))
+		if _, err := accept(ws); status.Code(err) != codes.NotFound {
+			mt.Errorf("invite of a removed member accepted: %v", err)
+		}
+	})
+}
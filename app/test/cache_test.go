@@ -0,0 +1,131 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// TestScrapeCache : fresh previews are reused, stale ones are revalidated with conditional requests
+func TestScrapeCache(t *testing.T) {
+	version, requests, conditional := "v1", 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") != "" {
+			conditional++
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>page %v</title></head></html>`, version)
+	}))
+	defer ts.Close()
+	cache, err := goscraper.NewDiskCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		url                  string
+		ttl                  time.Duration
+		version              string
+		title                string
+		cached               bool
+		requests, conditions int
+	}{
+		{ts.URL + "/page?b=2&a=1", time.Hour, "v1", "page v1", false, 1, 0},
+		{ts.URL + "/page?a=1&b=2&utm_source=x#top", time.Hour, "v1", "page v1", true, 1, 0}, // fresh
+		{ts.URL + "/page?a=1&b=2", 0, "v1", "page v1", true, 2, 1},                          // 304
+		{ts.URL + "/page?a=1&b=2", 0, "v2", "page v2", false, 3, 2},                         // modified
+		{ts.URL + "/page?a=1&b=2", time.Hour, "v2", "page v2", true, 3, 2},
+	}
+	for i, s := range steps {
+		version = s.version
+		doc, err := goscraper.ScrapeContext(context.Background(), s.url, goscraper.Options{Cache: cache, CacheTTL: s.ttl, DisableOEmbed: true})
+		if err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+		if doc.Preview.Title != s.title || doc.Cached != s.cached || doc.StatusCode != http.StatusOK || requests != s.requests || conditional != s.conditions {
+			t.Errorf("step %v: title %q, cached %v, status %v, %v requests (%v conditional)", i, doc.Preview.Title, doc.Cached, doc.StatusCode, requests, conditional)
+		}
+	}
+	if entries := cache.Entries(); len(entries) != 1 || entries[0].ETag != `"v2"` {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+// TestDiskCache : least recently used entries are removed, the others are kept across restarts
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := goscraper.NewDiskCache(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"https://a.example/", "https://b.example/"} {
+		cache.Put(&goscraper.CachedPreview{Key: key, StatusCode: 200, StoredAt: time.Now()})
+	}
+	cache.Get("https://a.example/") // b is the least recently used
+	cache.Put(&goscraper.CachedPreview{Key: "https://c.example/", StatusCode: 200, StoredAt: time.Now()})
+	if _, ok := cache.Get("https://b.example/"); ok {
+		t.Error("least recently used entry is kept")
+	}
+
+	cache.Get("https://a.example/") // kept in memory until Flush
+	if entries := cache.Entries(); len(entries) != 2 || entries[0].Key != "https://a.example/" || entries[0].UsedAt.Before(entries[1].UsedAt) {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	for _, flush := range []bool{false, true} {
+		if flush {
+			if err := cache.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reopened, err := goscraper.NewDiskCache(dir, 2) // the order of the files
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := map[bool]string{false: "https://c.example/", true: "https://a.example/"}[flush]
+		if entries := reopened.Entries(); len(entries) != 2 || entries[0].Key != first {
+			t.Errorf("restart (flushed: %v): unexpected entries %+v", flush, entries)
+		}
+	}
+
+	reopened, err := goscraper.NewDiskCache(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries := reopened.Entries(); len(entries) != 1 || entries[0].Key != "https://a.example/" {
+		t.Errorf("unexpected entries after restart: %+v", entries)
+	}
+	if !reopened.Delete("https://a.example/") || reopened.Delete("https://a.example/") {
+		t.Error("Delete does not report the removed entry")
+	}
+	reopened.Put(&goscraper.CachedPreview{Key: "https://d.example/"})
+	if n := reopened.Purge(); n != 1 || len(reopened.Entries()) != 0 {
+		t.Errorf("Purge removed %v entries", n)
+	}
+
+	cases := []struct {
+		in, want string
+	}{
+		{"HTTPS://Example.COM:443", "https://example.com/"},
+		{"http://example.com:8080/a?z=1&a=2&utm_medium=mail#section", "http://example.com:8080/a?a=2&z=1"},
+		{"http://example.com/#!/page", "http://example.com/#!/page"},
+		{"http://[::1]:80/x", "http://[::1]/x"},
+	}
+	for _, c := range cases {
+		u, _ := url.Parse(c.in)
+		if got := goscraper.NormalizeURL(u); got != c.want {
+			t.Errorf("NormalizeURL(%q) = %q (want %q)", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"crypto/tls"
+	"myTips/tipstocks/app/utils"
+	"myTips/tipstocks/app/utils/certs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCertsInit : generated certificates work for mutual TLS with every key type
+func TestCertsInit(t *testing.T) {
+	for _, keyType := range []string{certs.KeyRSA2048, certs.KeyECDSAP256, certs.KeyEd25519} {
+		dir := t.TempDir()
+		files := certs.DirFiles(dir)
+		opts := certs.DefaultOptions()
+		opts.KeyType = keyType
+		if err := certs.Init(files, opts); err != nil {
+			t.Fatalf("%v: cannot generate certificates: %v", keyType, err)
+		}
+		for _, key := range []string{files.CAKey, files.ServerKey, files.ClientKey} {
+			if info, err := os.Stat(key); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("%v: private key must be readable by the owner only: %v", key, err)
+			}
+		}
+		if err := certs.Init(files, opts); err == nil {
+			t.Errorf("%v: existing files are overwritten without force", keyType)
+		}
+
+		conf := utils.Configs{
+			TLSCert:       files.ServerCert,
+			TLSKey:        files.ServerKey,
+			TLSCA:         files.CACert,
+			TLSServerName: "localhost",
+			TLSClientAuth: true,
+			TLSClientCert: files.ClientCert,
+			TLSClientKey:  files.ClientKey,
+		}
+		if err := handshake(conf); err != nil {
+			t.Errorf("%v: mutual TLS handshake failed: %v", keyType, err)
+		}
+		conf.TLSServerName = "example.com" // not in the subjectAltNames
+		if err := handshake(conf); err == nil {
+			t.Errorf("%v: unknown server name is accepted", keyType)
+		}
+	}
+}
+
+// TestEnsureCerts : [tls] auto = true generates missing files only once
+func TestEnsureCerts(t *testing.T) {
+	dir := t.TempDir()
+	conf := utils.Configs{
+		TLSCert:       filepath.Join(dir, "server.crt"),
+		TLSKey:        filepath.Join(dir, "server.pem"),
+		TLSCA:         filepath.Join(dir, "ca.crt"),
+		TLSClientCert: filepath.Join(dir, "client.crt"),
+		TLSClientKey:  filepath.Join(dir, "client.pem"),
+		TLSHosts:      []string{"localhost"},
+	}
+	if created, err := conf.EnsureCerts(); err != nil || !created {
+		t.Fatal("certificates are not generated: ", err)
+	}
+	if created, err := conf.EnsureCerts(); err != nil || created {
+		t.Error("existing certificates are regenerated: ", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ca.key")); err != nil {
+		t.Error("CA key is not written next to the CA certificate: ", err)
+	}
+
+	// only the server certificate is issued again: the CA & the deployed client certificates are kept
+	ca, _ := os.ReadFile(conf.TLSCA)
+	client, _ := os.ReadFile(conf.TLSClientCert)
+	os.Remove(conf.TLSKey)
+	if created, err := conf.EnsureCerts(); err != nil || !created {
+		t.Fatal("server certificate is not generated: ", err)
+	}
+	newCA, _ := os.ReadFile(conf.TLSCA)
+	newClient, _ := os.ReadFile(conf.TLSClientCert)
+	if string(newCA) != string(ca) || string(newClient) != string(client) {
+		t.Error("the CA or the client certificate is replaced")
+	}
+	conf.TLSServerName, conf.TLSClientAuth = "localhost", true
+	if err := handshake(conf); err != nil {
+		t.Error("new server certificate is not issued by the CA: ", err)
+	}
+
+	// certificates without their CA are never replaced by a new CA
+	os.Remove(conf.TLSCA)
+	os.Remove(filepath.Join(dir, "ca.key"))
+	os.Remove(conf.TLSCert)
+	if _, err := conf.EnsureCerts(); err == nil {
+		t.Error("a new CA is generated next to the certificates of the old one")
+	}
+	if _, err := os.Stat(conf.TLSCA); err == nil {
+		t.Error("CA is written")
+	}
+}
+
+func handshake(conf utils.Configs) error {
+	serverConf, err := conf.ServerTLSConfig()
+	if err != nil {
+		return err
+	}
+	clientConf, err := conf.ClientTLSConfig()
+	if err != nil {
+		return err
+	}
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	c.SetDeadline(deadline)
+	s.SetDeadline(deadline)
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- tls.Server(s, serverConf).Handshake()
+	}()
+	clientErr := tls.Client(c, clientConf).Handshake()
+	if clientErr != nil {
+		s.Close() // unblock the server
+		<-serverErr
+		return clientErr
+	}
+	return <-serverErr
+}
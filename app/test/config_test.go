@@ -2,7 +2,9 @@ package test
 
 import (
 	"myTips/tipstocks/app/utils"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestLoadConf : passed!
@@ -11,3 +13,67 @@ func TestLoadConf(t *testing.T) {
 	// println(dir)
 	_ = utils.LoadConf("../utils/config.ini") // from app/test
 }
+
+// TestLoadPrecedence : defaults < config.ini < $TIPSTOCKS_* < overrides
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv("TIPSTOCKS_SERVER_PORT", "50070")
+	t.Setenv("TIPSTOCKS_SERVER_MAX_TIMEOUT", "1m")
+	conf, err := utils.Load("../utils/config.ini", []string{"server.max_timeout=5s", "cors.allowed_origins=*"})
+	if err != nil {
+		t.Fatal("Cannot load config.ini: ", err)
+	}
+	if conf.ServerPort != 50070 {
+		t.Error("environment variable is not applied: ", conf.ServerPort)
+	}
+	if conf.ServerMaxTimeout != 5*time.Second {
+		t.Error("override is not applied: ", conf.ServerMaxTimeout)
+	}
+	if len(conf.CORSAllowedOrigins) != 1 || conf.CORSAllowedOrigins[0] != "*" {
+		t.Error("list override is not applied: ", conf.CORSAllowedOrigins)
+	}
+	if conf.ClientPort != 8081 { // from config.ini
+		t.Error("config.ini is not applied: ", conf.ClientPort)
+	}
+	if _, err := utils.Load("../utils/config.ini", []string{"server.prot=1"}); err == nil {
+		t.Error("unknown setting is accepted")
+	}
+	t.Setenv("TIPSTOCKS_DB_PORT", "mongo")
+	if _, err := utils.Load("../utils/config.ini", nil); err == nil {
+		t.Error("invalid port is accepted")
+	}
+}
+
+// TestValidate : invalid settings are reported at startup
+func TestValidate(t *testing.T) {
+	conf := utils.LoadConf("../utils/config.ini")
+	conf.TLSEnabled = false                         // skip checking TLS files
+	conf.AuthServiceToken = strings.Repeat("x", 32) // given by $TIPSTOCKS_AUTH_SERVICE_TOKEN
+	if err := conf.Validate(); err != nil {
+		t.Error("shipped config.ini is invalid: ", err)
+	}
+	conf.AuthServiceToken = "short"
+	if err := conf.Validate(); err == nil {
+		t.Error("short service token is accepted")
+	}
+	conf.AuthEnabled = false
+	if err := conf.Validate(); err != nil {
+		t.Error("service token is required while auth is disabled: ", err)
+	}
+	conf.ScraperAllowedHosts = []string{"10.0.0.0/33"}
+	if err := conf.Validate(); err == nil {
+		t.Error("invalid CIDR range is accepted in scraper.allowed_hosts")
+	}
+	conf.ScraperAllowedHosts = []string{"wiki.intranet", "*.corp.example.com", "10.1.0.0/16", "::1"}
+	if err := conf.Validate(); err != nil {
+		t.Error("valid scraper.allowed_hosts is rejected: ", err)
+	}
+	conf.OIDCEnabled = true // without client_id
+	if err := conf.Validate(); err == nil {
+		t.Error("OIDC without client_id is accepted")
+	}
+	conf.ServerPort = 70000
+	conf.DBName = ""
+	if err := conf.Validate(); err == nil {
+		t.Error("invalid port & blank db name are accepted")
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"context"
+	"io"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// extractorPages : pages of the built-in extractors by url
+var extractorPages = map[string]string{
+	"https://github.com/golang/go": `<html><head><title>GitHub - golang/go: The Go programming language</title>
+<meta property="og:image" content="https://opengraph.githubassets.com/1/golang/go">
+<meta property="og:description" content="The Go programming language. Contribute to golang/go development by creating an account on GitHub."></head>
+<body><a id="repo-stars-counter-star" title="123,456">123k</a>
+<div class="BorderGrid-cell"><h2 class="h4 mb-3">Languages</h2><ul><li><a><span class="color-fg-default text-bold mr-1">Go</span><span>88.4%</span></a></li>
+<li><a><span class="color-fg-default text-bold mr-1">Assembly</span></a></li></ul></div></body></html>`,
+	"https://github.com/features/actions": `<html><head><title>Features · GitHub Actions</title></head></html>`,
+	"https://stackoverflow.com/questions/11227809/why-is-processing-a-sorted-array-faster": `<html><head>
+<title>java - Why is processing a sorted array faster? - Stack Overflow</title></head><body>
+<div id="question" itemprop="mainEntity" itemscope><div itemprop="upvoteCount" data-value="27189">27189</div>
+<a class="post-tag" href="/questions/tagged/java">java</a><a class="post-tag" href="/questions/tagged/c%2b%2b">c++</a>
+<span itemprop="answerCount">26</span></div>
+<div id="answers"><div class="answer js-accepted-answer accepted-answer" itemprop="acceptedAnswer" itemscope></div></div></body></html>`,
+	"https://superuser.com/questions/42/open-question": `<html><head><title>Open question - Super User</title></head><body>
+<div id="question"><div itemprop="upvoteCount" data-value="3"></div></div><h2 id="answers-header">2 Answers</h2></body></html>`,
+	"https://pypi.org/project/requests/": `<html><head><title>requests · PyPI</title></head><body>
+<h1 class="package-header__name">requests 2.32.3</h1><p class="package-description__summary">Python HTTP for Humans.</p></body></html>`,
+	"https://pkg.go.dev/golang.org/x/net@v0.30.0/html": `<html><head><title>html package</title></head></html>`,
+	"https://www.rfc-editor.org/rfc/rfc9110.html": `<html><head><title>RFC 9110: HTTP Semantics</title>
+<meta name="citation_title" content="HTTP Semantics"><meta name="citation_author" content="R. Fielding">
+<meta name="citation_author" content="M. Nottingham"><meta name="citation_author" content="J. Reschke">
+<meta name="citation_publication_date" content="June, 2022"></head>
+<body><pre>Internet Engineering Task Force (IETF)
+Category: Standards Track</pre></body></html>`,
+	"https://example.com/article":          `<html><head><title>plain page</title></head></html>`,
+	"https://docs.example.com/guide/intro": `<html><head><title>Guide</title></head><body><span class="version">v2</span></body></html>`,
+}
+
+// TestExtractors : built-in & registered extractors with a fake transport
+func TestExtractors(t *testing.T) {
+	client := &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		page, ok := extractorPages[req.URL.String()]
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusNotFound
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader(page)),
+			Request:    req,
+		}, nil
+	})}
+	goscraper.RegisterExtractor(goscraper.NewExtractor("docs", []string{"*.example.com/guide/**"}, func(u *url.URL, root *html.Node, p *goscraper.DocumentPreview) {
+		p.Fields["section"] = strings.Split(strings.Trim(u.Path, "/"), "/")[1]
+	}))
+
+	cases := []struct {
+		url, extractor, title, description, author string
+		fields                                     map[string]string
+		keywords                                   []string
+	}{
+		{"https://github.com/golang/go", "repository", "GitHub - golang/go: The Go programming language", "The Go programming language.", "",
+			map[string]string{"repository": "golang/go", "language": "Go", "stars": "123456"}, nil},
+		{"https://github.com/features/actions", "repository", "Features · GitHub Actions", "", "", map[string]string{}, nil},
+		{"https://stackoverflow.com/questions/11227809/why-is-processing-a-sorted-array-faster", "question", "java - Why is processing a sorted array faster?", "", "",
+			map[string]string{"score": "27189", "answers": "26", "answered": "accepted"}, []string{"java", "c++"}},
+		{"https://superuser.com/questions/42/open-question", "question", "Open question", "", "",
+			map[string]string{"score": "3", "answers": "2", "answered": "no"}, nil},
+		{"https://pypi.org/project/requests/", "package", "requests · PyPI", "Python HTTP for Humans.", "",
+			map[string]string{"registry": "PyPI", "package": "requests", "version": "2.32.3"}, nil},
+		{"https://pkg.go.dev/golang.org/x/net@v0.30.0/html", "package", "html package", "", "",
+			map[string]string{"registry": "Go", "package": "golang.org/x/net", "version": "v0.30.0/html"}, nil},
+		{"https://www.rfc-editor.org/rfc/rfc9110.html", "rfc", "RFC 9110: HTTP Semantics", "", "R. Fielding, M. Nottingham, J. Reschke",
+			map[string]string{"number": "9110", "status": "Standards Track"}, nil},
+		{"https://docs.example.com/guide/intro", "docs", "Guide", "", "", map[string]string{"section": "intro"}, nil},
+		{"https://example.com/article", "", "plain page", "", "", nil, nil},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), c.url, goscraper.Options{Client: client, DisableOEmbed: true})
+		if err != nil {
+			t.Errorf("%v: %v", c.url, err)
+			continue
+		}
+		p := doc.Preview
+		if p.Extractor != c.extractor || p.Title != c.title || p.Description != c.description || p.Author != c.author {
+			t.Errorf("%v: unexpected preview %+v", c.url, p)
+		}
+		if len(p.Fields) != len(c.fields) {
+			t.Errorf("%v: unexpected fields %v", c.url, p.Fields)
+		}
+		for k, v := range c.fields {
+			if p.Fields[k] != v {
+				t.Errorf("%v: %v = %q (want %q)", c.url, k, p.Fields[k], v)
+			}
+		}
+		if c.keywords != nil && strings.Join(p.Keywords, ",") != strings.Join(c.keywords, ",") {
+			t.Errorf("%v: unexpected keywords %v", c.url, p.Keywords)
+		}
+	}
+}
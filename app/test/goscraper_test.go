@@ -0,0 +1,289 @@
+package test
+
+import (
+	"context"
+	"io"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripper : fake transport answering without the network
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TestScrapeContext : options of the requests & a fake transport
+func TestScrapeContext(t *testing.T) {
+	var got *http.Request
+	client := &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		got = req
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+			Body:       io.NopCloser(strings.NewReader(`<html><head><title>fake</title><meta name="description" content="from the fake transport"></head></html>`)),
+			Request:    req,
+		}, nil
+	})}
+	doc, err := goscraper.ScrapeContext(context.Background(), "http://example.com/page", goscraper.Options{
+		Client:    client,
+		UserAgent: "tipstocks-test",
+		Headers:   http.Header{"Accept-Language": {"ja"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.Get("User-Agent") != "tipstocks-test" || got.Header.Get("Accept-Language") != "ja" {
+		t.Error("unexpected request headers: ", got.Header)
+	}
+	if doc.StatusCode != http.StatusOK || doc.Preview.Title != "fake" || doc.Preview.Description != "from the fake transport" {
+		t.Errorf("unexpected preview: %v %+v", doc.StatusCode, doc.Preview)
+	}
+}
+
+// TestScrapeTimeout : a hanging site doesn't block the caller
+func TestScrapeTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head>"))
+		w.(http.Flusher).Flush()
+		<-done // never finishes the body
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	start := time.Now()
+	_, err := goscraper.ScrapeContext(context.Background(), ts.URL, goscraper.Options{Timeout: 200 * time.Millisecond})
+	if err == nil {
+		t.Error("hanging body is scraped")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("timeout is not applied: ", elapsed)
+	}
+
+	// cancellation by the caller
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := goscraper.ScrapeContext(ctx, ts.URL, goscraper.Options{Timeout: -1}); err == nil {
+		t.Error("canceled request is scraped")
+	}
+}
+
+// TestScrapeContentTypes : the bodies of non-HTML responses are not downloaded
+func TestScrapeContentTypes(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, 2048))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		w.Header().Set("Content-Length", "3145728")
+		w.WriteHeader(http.StatusOK)
+		w.Write(make([]byte, 1024)) // the rest is never sent
+	})
+	done := make(chan struct{})
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>og</title><meta property="og:image" content="/og.png"></head><body>`))
+		w.(http.Flusher).Flush()
+		<-done // endless body after </head>
+	})
+	mux.HandleFunc("/touch", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>touch</title><link rel="apple-touch-icon" href="/touch.png"></head><body>`))
+		w.(http.Flusher).Flush()
+		<-done // any image of <head> is enough
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>large</title></head><body>`))
+		w.Write([]byte(strings.Repeat("<p>padding</p>", 10000)))
+		w.Write([]byte(`<img src="/never.png"></body></html>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	defer close(done)
+
+	cases := []struct {
+		path, title, description string
+		images                   []string
+	}{
+		{"/logo.png", "logo.png", "Image (png), 2.0 KB", []string{ts.URL + "/logo.png"}},
+		{"/download", "report.pdf", "PDF document, 3.0 MB", []string{}},
+		{"/stream", "og", "", []string{ts.URL + "/og.png"}},
+		{"/touch", "touch", "", []string{ts.URL + "/touch.png"}},
+		{"/large", "large", "", []string{}},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+c.path, goscraper.Options{Timeout: 2 * time.Second, MaxBodySize: 64 << 10})
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		p := doc.Preview
+		if p.Title != c.title || p.Description != c.description || strings.Join(p.Images, ",") != strings.Join(c.images, ",") {
+			t.Errorf("%v: unexpected preview %+v", c.path, p)
+		}
+	}
+}
+
+// TestScrapeStructuredData : precedence of Open Graph, Twitter cards, JSON-LD, microdata & HTML
+func TestScrapeStructuredData(t *testing.T) {
+	pages := map[string]string{
+		"/twitter": `<html lang="fr"><head><title>html title</title>
+<meta name="twitter:card" content="summary"><meta name="twitter:title" content="twitter title">
+<meta name="twitter:description" content="twitter description"><meta name="twitter:image" content="/card.png">
+<meta name="twitter:creator" content="@alice"></head></html>`,
+		"/jsonld": `<html><head><meta property="og:title" content="og title" data-extra="ignored">
+<meta property="og:type" content="article"><meta property="og:locale" content="en_US">
+<meta property="article:author" content="https://example.com/alice">
+<meta property="article:tag" content="go"><meta property="article:tag" content="grpc">
+<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [
+ {"@type": "WebSite", "name": "Example"},
+ {"@type": "NewsArticle", "headline": "ld headline", "description": "ld description", "image": ["/ld.png"],
+  "author": [{"@type": "Person", "name": "Alice"}, {"@type": "Person", "name": "Bob"}],
+  "datePublished": "2024-05-01T10:00:00Z"}]}</script>
+<script type="application/ld+json">{broken</script></head></html>`,
+		"/microdata": `<html><head><title>html title</title><meta name="keywords" content="tips, Go, go"></head>
+<body><div itemscope itemtype="https://schema.org/BreadcrumbList"><span itemprop="name">crumb</span></div>
+<article itemscope itemtype="https://schema.org/BlogPosting">
+ <h1 itemprop="headline">micro headline</h1>
+ <div itemprop="author" itemscope itemtype="https://schema.org/Person"><div><span itemprop="name">Carol</span></div></div>
+ <time itemprop="datePublished" datetime="2023-01-02">Jan 2</time>
+ <div><img itemprop="image" src="/micro.png"></div>
+ <div itemprop="publisher" itemscope><meta itemprop="name" content="Blog"></div>
+ <p itemprop="description">micro description</p>
+</article></body></html>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		path string
+		want goscraper.DocumentPreview
+	}{
+		{"/twitter", goscraper.DocumentPreview{Title: "twitter title", Description: "twitter description",
+			Images: []string{ts.URL + "/card.png"}, Author: "@alice", Keywords: []string{}, Locale: "fr"}},
+		{"/jsonld", goscraper.DocumentPreview{Name: "Example", Title: "og title", Description: "ld description",
+			Images: []string{ts.URL + "/ld.png"}, Author: "Alice, Bob", PublishedTime: "2024-05-01T10:00:00Z",
+			Keywords: []string{"go", "grpc"}, Type: "article", Locale: "en_US"}},
+		{"/microdata", goscraper.DocumentPreview{Name: "Blog", Title: "micro headline", Description: "micro description",
+			Images: []string{ts.URL + "/micro.png"}, Author: "Carol", PublishedTime: "2023-01-02",
+			Keywords: []string{"tips", "Go"}, Type: "BlogPosting"}},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+c.path, goscraper.Options{})
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		p, w := doc.Preview, c.want
+		if w.Name == "" {
+			w.Name = strings.TrimPrefix(ts.URL, "http://")
+		}
+		if p.Name != w.Name || p.Title != w.Title || p.Description != w.Description || p.Author != w.Author ||
+			p.PublishedTime != w.PublishedTime || p.Type != w.Type || p.Locale != w.Locale ||
+			strings.Join(p.Images, ",") != strings.Join(w.Images, ",") || strings.Join(p.Keywords, ",") != strings.Join(w.Keywords, ",") {
+			t.Errorf("%v: unexpected preview\n%+v\nwant\n%+v", c.path, p, w)
+		}
+	}
+}
+
+// TestScrapeResolveUrls : relative URLs of tricky pages resolved against the base of the document
+func TestScrapeResolveUrls(t *testing.T) {
+	pages := map[string]string{
+		"/query/page":  `<html><head><meta property="og:image" content="/img.png?w=600&amp;h=315"></head></html>`,
+		"/base/page":   `<html><head><base href="https://cdn.example.com/assets/"><link rel="icon" href="favicon.png"><meta property="og:image" content="og.png"></head></html>`,
+		"/late/page":   `<html><head><link rel="icon" href="icon.png"><base href="/static/"></head><body><img src="a.png"></body></html>`,
+		"/blog/post/":  `<html><head><link rel="shortcut icon" href="favicon.png"></head><body><img src="../img.png"><img src="./b c.png"></body></html>`,
+		"/cdn/page":    `<html><head><meta name="twitter:image" content="//cdn.example.com/card.png?v=2"></head></html>`,
+		"/schemes":     `<html><body><img src="data:image/png;base64,AAAA"><img src="javascript:void(0)"><img src="  /ok.png  "></body></html>`,
+		"/old":         `<html><head><link rel="canonical" href="new?id=1"><title>old</title></head><body></body></html>`,
+		"/new":         `<html><head><title>new</title><meta property="og:image" content="og.png"></head></html>`,
+		"/self":        `<html><head><link rel="canonical" href="/self"><title>self</title></head><body></body></html>`,
+		"/jsonld/page": `<html><head><script type="application/ld+json">{"@type": "Article", "image": "../ld.png"}</script></head></html>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		path, title, icon string
+		images            []string
+	}{
+		{"/query/page", "", ts.URL + "/favicon.ico", []string{ts.URL + "/img.png?w=600&h=315"}},
+		{"/base/page", "", "https://cdn.example.com/assets/favicon.png", []string{"https://cdn.example.com/assets/og.png"}},
+		{"/late/page", "", ts.URL + "/static/icon.png", []string{ts.URL + "/static/a.png"}},
+		{"/blog/post/", "", ts.URL + "/blog/post/favicon.png", []string{ts.URL + "/blog/img.png", ts.URL + "/blog/post/b%20c.png"}},
+		{"/cdn/page", "", ts.URL + "/favicon.ico", []string{"http://cdn.example.com/card.png?v=2"}},
+		{"/schemes", "", ts.URL + "/favicon.ico", []string{ts.URL + "/ok.png"}},
+		{"/old", "new", ts.URL + "/favicon.ico", []string{ts.URL + "/og.png"}},
+		{"/self", "self", ts.URL + "/favicon.ico", []string{}},
+		{"/jsonld/page", "", ts.URL + "/favicon.ico", []string{ts.URL + "/ld.png"}},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+c.path, goscraper.Options{MaxRedirect: 3})
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		p := doc.Preview
+		if p.Title != c.title || p.Icon != c.icon || strings.Join(p.Images, ",") != strings.Join(c.images, ",") {
+			t.Errorf("%v: unexpected preview %+v", c.path, p)
+		}
+	}
+}
+
+// TestScrapeImageCandidates : pixels, sprites & data URIs are dropped, the rest is ranked
+func TestScrapeImageCandidates(t *testing.T) {
+	pages := map[string]string{
+		"/article": `<html><head><link rel="apple-touch-icon" sizes="180x180" href="/touch.png">
+<script type="application/ld+json">{"@type": "Article", "image": "/ld.png"}</script></head><body>
+<img src="/logo.png" width="120" height="40"><img src="https://tracker.example.com/pixel.gif">
+<img src="/dot.gif" width="1" height="1"><img src="/icons.svg#share"><img src="data:image/gif;base64,R0lGOD">
+<img src="data:image/gif;base64,R0lGOD" data-src="/lazy.jpg" width="800" height="600">
+<img src="/photo.jpg" width="640" height="480"><img src="/thumb.jpg" width="64" height="64"><img src="/ld.png"></body></html>`,
+		"/og": `<html><head><meta property="og:image" content="/small.png"><meta property="og:image:width" content="50">
+<meta property="og:image" content="/large.png"><meta property="og:image:width" content="1200"><meta property="og:image:height" content="630">
+<meta name="twitter:image" content="/card.png"></head></html>`,
+		"/none": `<html><body><img src="/spacer.gif"></body></html>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(pages[r.URL.Path]))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		path   string
+		images []string
+	}{
+		{"/article", []string{"/ld.png", "/lazy.jpg", "/photo.jpg", "/touch.png", "/thumb.jpg", "/logo.png"}},
+		{"/og", []string{"/large.png", "/card.png", "/small.png"}},
+		{"/none", []string{}},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+c.path, goscraper.Options{})
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		want := []string{}
+		for _, img := range c.images {
+			want = append(want, ts.URL+img)
+		}
+		if strings.Join(doc.Preview.Images, ",") != strings.Join(want, ",") || len(doc.Preview.ImageCandidates) != len(want) {
+			t.Errorf("%v: unexpected candidates %+v", c.path, doc.Preview.ImageCandidates)
+		}
+	}
+}
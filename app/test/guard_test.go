@@ -0,0 +1,69 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestGuard : private addresses are blocked after resolution & on redirects, unless allowed
+func TestGuard(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>internal page</title>
+<link type="application/json+oembed" href="http://169.254.169.254/latest/meta-data/"></head></html>`))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, ts.URL+"/page", http.StatusFound) // 127.0.0.1
+	})
+	u, _ := url.Parse(ts.URL)
+	byName := "http://localhost:" + u.Port()
+
+	guard, _ := goscraper.NewGuard(nil)
+	allowName, _ := goscraper.NewGuard([]string{"localhost"})
+	allowRange, _ := goscraper.NewGuard([]string{"127.0.0.0/8"})
+	cases := []struct {
+		url    string
+		guard  *goscraper.Guard
+		reason string // "" if fetched
+	}{
+		{ts.URL + "/page", guard, "loopback"},
+		{byName + "/page", guard, "loopback"}, // resolved
+		{"http://169.254.169.254/latest/meta-data/", guard, "metadata"},
+		{"http://[::ffff:10.0.0.1]/", guard, "private"},
+		{"http://[2002:7f00:1::]/", guard, "6to4"},                          // 127.0.0.1
+		{"http://[2001:0:4136:e378:8000:63bf:80ff:fffe]/", guard, "Teredo"}, // client 127.0.0.1
+		{"file:///etc/passwd", guard, "only http & https"},
+		{byName + "/redirect", allowName, "loopback"},
+		{byName + "/page", allowName, ""},
+		{ts.URL + "/redirect", allowRange, ""},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), c.url, goscraper.Options{Guard: c.guard})
+		var blocked *goscraper.BlockedError
+		if c.reason == "" {
+			if err != nil || doc.Preview.Title != "internal page" || doc.Preview.OEmbed != nil {
+				t.Errorf("%v: unexpected result %v %+v", c.url, err, doc)
+			}
+		} else if !errors.As(err, &blocked) || !strings.Contains(blocked.Reason, c.reason) {
+			t.Errorf("%v: not blocked as %v: %v", c.url, c.reason, err)
+		}
+	}
+
+	if _, err := goscraper.NewGuard([]string{"10.0.0.0/40"}); err == nil {
+		t.Error("invalid range is allowed")
+	}
+	for _, host := range []string{"93.184.215.14", "[2001:4860:4860::8888]"} {
+		if err := guard.CheckURL(context.Background(), &url.URL{Scheme: "https", Host: host}); err != nil {
+			t.Error("public address is blocked: ", err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// oembedServer : pages & a fake oEmbed provider
+func oembedServer(t *testing.T) (*httptest.Server, *[]string) {
+	requested := &[]string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><title>page title</title>
+<link rel="alternate" type="application/json+oembed" href="/oembed?url=%v&amp;format=json">
+<link rel="alternate" type="text/xml+oembed" href="/oembed.xml"></head></html>`, r.URL.Path)
+	})
+	mux.HandleFunc("/videos/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><meta property="og:title" content="og title"><meta property="og:image" content="/og.png"></head></html>`))
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		*requested = append(*requested, r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "video", "version": "1.0", "title": "oEmbed title", "author_name": "Alice",
+"author_url": "https://example.com/alice", "provider_name": "FakeTube", "thumbnail_url": "/thumb.jpg",
+"thumbnail_width": 480, "thumbnail_height": "360", "width": "640", "height": 360,
+"html": "<iframe src=\"https://player.example.com/1\" width=\"640\" onload=\"alert(1)\"></iframe><script>alert(1)</script>"}`))
+	})
+	mux.HandleFunc("/api/oembed.json", func(w http.ResponseWriter, r *http.Request) {
+		*requested = append(*requested, r.URL.RawQuery)
+		w.Write([]byte(`{"type": "rich", "title": "registry title", "html": "<blockquote>post</blockquote>"}`))
+	})
+	mux.HandleFunc("/broken/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>broken</title><link type="application/json+oembed" href="/missing"></head></html>`))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, requested
+}
+
+// TestScrapeOEmbed : discovery, registry & failing providers
+func TestScrapeOEmbed(t *testing.T) {
+	ts, requested := oembedServer(t)
+	registry := []goscraper.OEmbedProvider{{Name: "Fake", Schemes: []string{ts.URL + "/videos/*"}, Endpoint: ts.URL + "/api/oembed.{format}"}}
+
+	// discovered in the page
+	doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+"/watch", goscraper.Options{OEmbedProviders: registry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := doc.Preview.OEmbed
+	if o == nil {
+		t.Fatal("oEmbed is not discovered")
+	}
+	if o.Type != "video" || o.Title != "oEmbed title" || o.AuthorName != "Alice" || o.ProviderName != "FakeTube" ||
+		o.ThumbnailWidth != 480 || o.ThumbnailHeight != 360 || o.Width != 640 || o.Height != 360 || !strings.Contains(o.HTML, "<iframe") {
+		t.Errorf("unexpected oEmbed: %+v", o)
+	}
+	if doc.Preview.Title != "page title" || doc.Preview.Author != "Alice" || len(doc.Preview.Images) != 1 || doc.Preview.Images[0] != ts.URL+"/thumb.jpg" {
+		t.Errorf("unexpected preview: %+v", doc.Preview)
+	}
+	if len(*requested) != 1 || (*requested)[0] != "url=/watch&format=json" {
+		t.Errorf("unexpected requests to the provider: %v", *requested)
+	}
+
+	// from the registry: the thumbnail of the provider would win, the og:image is kept without one
+	*requested = nil
+	doc, err = goscraper.ScrapeContext(context.Background(), ts.URL+"/videos/1", goscraper.Options{OEmbedProviders: registry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Preview.OEmbed == nil || doc.Preview.OEmbed.Title != "registry title" || doc.Preview.Title != "og title" || doc.Preview.Images[0] != ts.URL+"/og.png" {
+		t.Errorf("unexpected preview: %+v %+v", doc.Preview, doc.Preview.OEmbed)
+	}
+	if len(*requested) != 1 || !strings.HasPrefix((*requested)[0], "url="+strings.ReplaceAll(strings.ReplaceAll(ts.URL, ":", "%3A"), "/", "%2F")) {
+		t.Errorf("unexpected requests to the provider: %v", *requested)
+	}
+
+	// failing provider, turned off
+	cases := []struct {
+		path string
+		opts goscraper.Options
+	}{
+		{"/broken/1", goscraper.Options{OEmbedProviders: registry}},
+		{"/videos/1", goscraper.Options{OEmbedProviders: registry, DisableOEmbed: true}},
+		{"/videos/1", goscraper.Options{OEmbedProviders: []goscraper.OEmbedProvider{}}},
+	}
+	for _, c := range cases {
+		doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+c.path, c.opts)
+		if err != nil {
+			t.Errorf("%v: %v", c.path, err)
+			continue
+		}
+		if doc.Preview.OEmbed != nil || doc.Preview.Title == "" {
+			t.Errorf("%v: unexpected preview %+v", c.path, doc.Preview)
+		}
+	}
+}
+
+// TestParseOEmbedProviders : registry in the format of oembed.com
+func TestParseOEmbedProviders(t *testing.T) {
+	providers, err := goscraper.ParseOEmbedProviders(strings.NewReader(`[
+{"provider_name": "Vimeo", "provider_url": "https://vimeo.com/", "endpoints": [
+  {"schemes": ["https://vimeo.com/*", "https://vimeo.com/album/*/video/*"], "url": "https://vimeo.com/api/oembed.{format}", "discovery": true}]},
+{"provider_name": "Discovery only", "provider_url": "https://example.com/", "endpoints": [{"url": "https://example.com/oembed", "discovery": true}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(providers) != 1 || providers[0].Name != "Vimeo" || len(providers[0].Schemes) != 2 || providers[0].Endpoint != "https://vimeo.com/api/oembed.{format}" {
+		t.Errorf("unexpected providers: %+v", providers)
+	}
+	if _, err := goscraper.ParseOEmbedProviders(strings.NewReader(`{"not": "a list"}`)); err == nil {
+		t.Error("invalid registry is parsed")
+	}
+}
+
+// TestSanitizeEmbed : only safe elements, attributes & urls are kept
+func TestSanitizeEmbed(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{`<iframe src="https://www.youtube.com/embed/x" width="560" height="315" frameborder="0" allow="autoplay; camera; encrypted-media" allowfullscreen onload="alert(1)"></iframe>`,
+			`<iframe src="https://www.youtube.com/embed/x" width="560" height="315" allow="autoplay; encrypted-media" allowfullscreen="" frameborder="0" sandbox="allow-scripts allow-popups allow-presentation" referrerpolicy="strict-origin-when-cross-origin"></iframe>`},
+		{`<blockquote class="twitter-tweet"><p lang="en">Hello <a href="https://t.co/x">link</a></p></blockquote><script async src="https://platform.twitter.com/widgets.js"></script>`,
+			`<blockquote><p>Hello <a href="https://t.co/x" target="_blank" rel="noopener noreferrer nofollow">link</a></p></blockquote>`},
+		{`<a href="javascript:alert(1)">x</a><img src="data:image/png;base64,AAAA"><iframe src="//player.example.com/1"></iframe>`,
+			`<a target="_blank" rel="noopener noreferrer nofollow">x</a><iframe src="https://player.example.com/1" sandbox="allow-scripts allow-popups allow-presentation" referrerpolicy="strict-origin-when-cross-origin"></iframe>`},
+		{`<div><style>body{display:none}</style><p>unclosed <b>bold</div></p></span><object data="x.swf"></object>&lt;script&gt;`,
+			`<div><p>unclosed <b>bold</b></p></div>&lt;script&gt;`},
+		{`<iframe src="http://TIPS.example:8081/admin/cache/purge">fallback</iframe><iframe src="https://tips.example/"></iframe><p>x</p>`, // the app itself
+			`<p>x</p>`},
+	}
+	for _, c := range cases {
+		if got := goscraper.SanitizeEmbed(c.in, "tips.example:8081"); got != c.want {
+			t.Errorf("SanitizeEmbed(%q)\n got %q\nwant %q", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"myTips/tipstocks/app/utils/goscraper"
+	"myTips/tipstocks/app/utils/goscraper/pdf"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// classicPDF : PDF 1.4 with the metadata in the document information dictionary
+func classicPDF() []byte {
+	b := &bytes.Buffer{}
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	b.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	b.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 >>\nendobj\n")
+	for i := 3; i <= 5; i++ {
+		fmt.Fprintf(b, "%d 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>\nendobj\n", i)
+	}
+	// UTF-16BE title, escaped parentheses & octal in the author
+	b.WriteString("6 0 obj\n<< /Title <FEFF00540069007000730020002D0020306E30593068> /Author (Alice \\(ed.\\) \\351) /Subject (A spec) >>\nendobj\n")
+	b.WriteString("trailer\n<< /Size 7 /Root 1 0 R /Info 6 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// compressedPDF : PDF 1.5 with an object stream, a cross-reference stream & XMP metadata
+func compressedPDF() []byte {
+	deflate := func(data string) []byte {
+		z := &bytes.Buffer{}
+		w := zlib.NewWriter(z)
+		w.Write([]byte(data))
+		w.Close()
+		return z.Bytes()
+	}
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 4 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 12 >>",
+		"<< /Producer (test) >>",
+	}
+	header, body := "", ""
+	for i, o := range objs {
+		header += fmt.Sprintf("%d %d ", i+1, len(body))
+		body += o + "\n"
+	}
+	objStm := deflate(header + body)
+	xmp := deflate(`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" pdf:Keywords="grpc, go">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Tipstocks Design</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>Alice</rdf:li><rdf:li>Bob</rdf:li></rdf:Seq></dc:creator>
+</rdf:Description></rdf:RDF></x:xmpmeta>
+<?xpacket end="w"?>`)
+
+	b := &bytes.Buffer{}
+	b.WriteString("%PDF-1.5\n")
+	fmt.Fprintf(b, "5 0 obj\n<< /Type /ObjStm /N %d /First %d /Length %d /Filter /FlateDecode >>\nstream\n", len(objs), len(header), len(objStm))
+	b.Write(objStm)
+	b.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(b, "4 0 obj\n<< /Type /Metadata /Subtype /XML /Length 7 0 R /Filter /FlateDecode >>\nstream\n")
+	b.Write(xmp)
+	b.WriteString("\nendstream\nendobj\n")
+	fmt.Fprintf(b, "7 0 obj\n%d\nendobj\n", len(xmp))
+	// the entries of the xref stream are not read (the objects are found by scanning)
+	b.WriteString("6 0 obj\n<< /Type /XRef /Size 8 /W [1 2 1] /Root 1 0 R /Info 3 0 R /Length 0 >>\nstream\n\nendstream\nendobj\n")
+	b.WriteString("startxref\n0\n%%EOF\n")
+	return b.Bytes()
+}
+
+// TestPDFExtract : metadata of the information dictionary, XMP & page count
+func TestPDFExtract(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want pdf.Info
+	}{
+		{"classic", classicPDF(), pdf.Info{Title: "Tips - のすと", Author: "Alice (ed.) é", Subject: "A spec", Pages: 3}},
+		{"compressed", compressedPDF(), pdf.Info{Title: "Tipstocks Design", Author: "Alice, Bob", Keywords: "grpc, go", Pages: 12}},
+	}
+	for _, c := range cases {
+		info, err := pdf.Extract(c.data)
+		if err != nil {
+			t.Errorf("%v: %v", c.name, err)
+			continue
+		}
+		if *info != c.want {
+			t.Errorf("%v: %+v (want %+v)", c.name, *info, c.want)
+		}
+	}
+	if _, err := pdf.Extract([]byte("<html></html>")); err != pdf.ErrNotPDF {
+		t.Error("HTML is parsed as PDF: ", err)
+	}
+	// truncated & garbage documents must not panic
+	data := compressedPDF()
+	for i := 0; i < len(data); i += 37 {
+		pdf.Extract(data[:i])
+	}
+}
+
+// TestScrapePDF : preview of a PDF document served without a Content-Type
+func TestScrapePDF(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil // sniffed from %PDF-
+		w.Write(classicPDF())
+	}))
+	defer ts.Close()
+	doc, err := goscraper.ScrapeContext(context.Background(), ts.URL+"/papers/spec.pdf", goscraper.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := doc.Preview
+	if p.Title != "Tips - のすと" || p.Author != "Alice (ed.) é" || p.Description != "A spec" || p.Pages != 3 || len(p.Images) != 0 {
+		t.Errorf("unexpected preview: %+v", p)
+	}
+
+	// too large to be downloaded: preview of the file
+	doc, err = goscraper.ScrapeContext(context.Background(), ts.URL+"/papers/spec.pdf", goscraper.Options{MaxPDFSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Preview.Title != "spec.pdf" || doc.Preview.Pages != 0 {
+		t.Errorf("unexpected preview: %+v", doc.Preview)
+	}
+}
@@ -7,12 +7,14 @@ import (
 	"myTips/tipstocks/app/protobuf"
 	"myTips/tipstocks/app/utils"
 	"myTips/tipstocks/app/utils/goscraper"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -20,16 +22,19 @@ import (
 func TestGRPC(t *testing.T) {
 	opts := grpc.WithInsecure()
 	conf := utils.LoadConf("../utils/config.ini")
-	if !conf.ServerDebug {
-		certFile := "../ssl/ca.crt"
-		creds, sslErr := credentials.NewClientTLSFromFile(certFile, "")
+	if conf.TLSEnabled {
+		// paths in config.ini are relative to the root of the repository
+		conf.TLSCA = filepath.Join("../..", conf.TLSCA)
+		conf.TLSClientCert = filepath.Join("../..", conf.TLSClientCert)
+		conf.TLSClientKey = filepath.Join("../..", conf.TLSClientKey)
+		tlsConf, sslErr := conf.ClientTLSConfig()
 		if sslErr != nil {
-			t.Error("Error while loading CA trust certificate: ", sslErr)
+			t.Error("Error while loading certificates: ", sslErr)
 		}
-		opts = grpc.WithTransportCredentials(creds)
+		opts = grpc.WithTransportCredentials(credentials.NewTLS(tlsConf))
 	}
 	target := fmt.Sprintf("localhost:%v", conf.ServerPort)
-	cc, err := grpc.Dial(target, opts)
+	cc, err := grpc.Dial(target, opts, grpc.WithPerRPCCredentials(utils.BearerToken(conf.AuthServiceToken, conf.TLSEnabled)))
 	if err != nil {
 		t.Error("could not connect: ", err)
 	}
@@ -37,6 +42,7 @@ func TestGRPC(t *testing.T) {
 	c := protobuf.NewTipServiceClient(cc)
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, utils.UnscopedMetadataKey, "true") // the tips of every user
 	// test gRPC functions
 	newTip := createTip(ctx, t, c)
 	allTips(ctx, t, c)
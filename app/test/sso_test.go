@@ -0,0 +1,214 @@
+package test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"myTips/tipstocks/app/utils/sso"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockOIDC : OpenID Connect provider issuing RS256 ID tokens for the authorization code flow with PKCE
+type mockOIDC struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{} // claims of the next ID token (+ iss, aud, exp, iat, nonce)
+
+	mu    sync.Mutex
+	codes map[string]authRequest // code -> request
+}
+
+type authRequest struct {
+	clientID  string
+	nonce     string
+	challenge string
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{key: key, codes: map[string]authRequest{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		req, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		clientID, secret, _ := r.BasicAuth()
+		if clientID == "" {
+			clientID, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || clientID != req.clientID || secret != "secret" ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     m.idToken(t, req),
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// authorize : what the provider does after the user signs in (returns the callback query)
+func (m *mockOIDC) authorize(t *testing.T, authURL string) url.Values {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Error("PKCE challenge is missing: ", authURL)
+	}
+	code := "code-" + q.Get("state")[:8]
+	m.mu.Lock()
+	m.codes[code] = authRequest{clientID: q.Get("client_id"), nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	m.mu.Unlock()
+	return url.Values{"code": {code}, "state": {q.Get("state")}}
+}
+
+func (m *mockOIDC) idToken(t *testing.T, req authRequest) string {
+	claims := map[string]interface{}{
+		"iss":   m.URL,
+		"aud":   req.clientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": req.nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// TestSSOLogin : authorization code + PKCE flow against the mock provider
+func TestSSOLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	defer m.Close()
+	m.claims = map[string]interface{}{
+		"sub":                "user-1",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+	}
+	ctx := context.Background()
+	p, err := sso.New(ctx, sso.Config{
+		Issuer:         m.URL,
+		ClientID:       "tipstocks",
+		ClientSecret:   "secret",
+		RedirectURL:    "http://localhost:8081/login/oidc/callback",
+		AllowedDomains: []string{"example.com"},
+	})
+	if err != nil {
+		t.Fatal("cannot discover the mock provider: ", err)
+	}
+
+	authURL, flow, err := p.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, m.URL+"/authorize?") {
+		t.Error("unexpected authorization URL: ", authURL)
+	}
+	callback := m.authorize(t, authURL)
+	id, err := p.Finish(ctx, flow, callback.Get("state"), callback.Get("code"))
+	if err != nil {
+		t.Fatal("login failed: ", err)
+	}
+	if id.Issuer != m.URL || id.Subject != "user-1" || id.Email != "alice@example.com" || id.Username() != "alice" {
+		t.Errorf("unexpected identity: %+v (%v)", id, id.Username())
+	}
+
+	// forged state
+	_, flow, _ = p.Begin()
+	callback = m.authorize(t, authURL)
+	if _, err := p.Finish(ctx, flow, callback.Get("state"), callback.Get("code")); err == nil {
+		t.Error("state of another flow is accepted")
+	}
+
+	// code intercepted without the PKCE verifier
+	authURL, flow, _ = p.Begin()
+	callback = m.authorize(t, authURL)
+	stolen := *flow
+	stolen.Verifier = "wrong-verifier-wrong-verifier-wrong-verifier"
+	if _, err := p.Finish(ctx, &stolen, callback.Get("state"), callback.Get("code")); err == nil {
+		t.Error("code is exchanged without the PKCE verifier")
+	}
+
+	// email domain out of [oidc] allowed_domains
+	m.claims["email"] = "mallory@evil.example"
+	authURL, flow, _ = p.Begin()
+	callback = m.authorize(t, authURL)
+	if _, err := p.Finish(ctx, flow, callback.Get("state"), callback.Get("code")); err != sso.ErrDomainNotAllowed {
+		t.Error("email domain is not checked: ", err)
+	}
+}
+
+// TestSSOUsername : tipstocks usernames from the claims
+func TestSSOUsername(t *testing.T) {
+	cases := []struct {
+		id   sso.Identity
+		want string
+	}{
+		{sso.Identity{PreferredUsername: "alice", Email: "a@example.com"}, "alice"},
+		{sso.Identity{Email: "bob.smith@example.com"}, "bob.smith"},
+		{sso.Identity{PreferredUsername: "日本", Email: "jp@example.com", Subject: "1"}, "user-1"},
+		{sso.Identity{Subject: "1234567890"}, "user-1234567890"},
+	}
+	for _, c := range cases {
+		if got := c.id.Username(); got != c.want {
+			t.Errorf("%+v: %v (want %v)", c.id, got, c.want)
+		}
+	}
+}
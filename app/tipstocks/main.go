@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"myTips/tipstocks/app/utils/certs"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: tipstocks <command> [flags]
+
+Commands:
+  certs init    generate a CA, and server & client certificates for [tls] in config.ini
+
+Run "tipstocks certs init -h" for the flags.
+`
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "certs" || os.Args[2] != "init" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := certsInit(os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, "certs init:", err)
+		os.Exit(1)
+	}
+}
+
+// certsInit : tipstocks certs init [flags]
+func certsInit(args []string) error {
+	def := certs.DefaultOptions()
+	fs := flag.NewFlagSet("certs init", flag.ExitOnError)
+	dir := fs.String("dir", "app/ssl", "output directory (ca.crt, ca.key, server.crt, server.pem, client.crt, client.pem)")
+	hosts := fs.String("hosts", strings.Join(def.Hosts, ","), "comma-separated DNS names & IP addresses of the server certificate")
+	keyType := fs.String("key-type", def.KeyType, "key type: "+strings.Join(certs.KeyTypes, ", "))
+	days := fs.Int("days", int(def.Validity/(24*time.Hour)), "validity of the certificates in days")
+	force := fs.Bool("force", false, "overwrite existing files")
+	fs.Parse(args)
+
+	opts := certs.Options{
+		KeyType:  *keyType,
+		Validity: time.Duration(*days) * 24 * time.Hour,
+		Force:    *force,
+	}
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			opts.Hosts = append(opts.Hosts, h)
+		}
+	}
+	if err := certs.Init(certs.DirFiles(*dir), opts); err != nil {
+		return err
+	}
+	fmt.Printf("Generated certificates in %v (server: %v, key: %v, valid for %v days)\n", *dir, strings.Join(opts.Hosts, ", "), opts.KeyType, *days)
+	return nil
+}
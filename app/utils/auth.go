@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"myTips/tipstocks/app/utils/sso"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// UserMetadataKey : gRPC metadata of the user signed in to the web client
+// the server only trusts it from the caller with the service token
+const UserMetadataKey = "x-tipstocks-user-id"
+
+// UnscopedMetadataKey : gRPC metadata ("true") of the service token calling without a user,
+// to administrate the tips & tokens of every user (the calls without a user are rejected otherwise)
+const UnscopedMetadataKey = "x-tipstocks-unscoped"
+
+// WorkspaceMetadataKey : gRPC metadata of the workspace which TipService calls are scoped to
+// (the personal workspace of the user if missing, the membership is checked by the server)
+const WorkspaceMetadataKey = "x-tipstocks-workspace-id"
+
+// bearerToken : grpc.PerRPCCredentials sending "authorization: Bearer <token>"
+type bearerToken struct {
+	token      string
+	requireTLS bool
+}
+
+// BearerToken : credentials of [auth] service_token for grpc.WithPerRPCCredentials
+// the token is only sent over TLS unless [tls] enabled = false
+func BearerToken(token string, requireTLS bool) credentials.PerRPCCredentials {
+	return bearerToken{token: token, requireTLS: requireTLS}
+}
+
+// bearerTokenKey : key of the token replacing the one of BearerToken in a context
+type bearerTokenKey struct{}
+
+// WithBearerToken : ctx whose calls send token instead of the token of BearerToken
+// (e.g. a personal access token forwarded by the web client)
+func WithBearerToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, bearerTokenKey{}, token)
+}
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if token, ok := ctx.Value(bearerTokenKey{}).(string); ok {
+		return map[string]string{"authorization": "Bearer " + token}, nil
+	}
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+// SSOConfig : [oidc] section for sso.New
+func (conf Configs) SSOConfig() sso.Config {
+	return sso.Config{
+		Issuer:         conf.OIDCIssuer,
+		ClientID:       conf.OIDCClientID,
+		ClientSecret:   conf.OIDCClientSecret,
+		RedirectURL:    conf.OIDCRedirectURL,
+		AllowedDomains: conf.OIDCAllowedDomains,
+	}
+}
@@ -0,0 +1,338 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// key types of the generated certificates
+const (
+	KeyRSA2048   = "rsa2048"
+	KeyRSA4096   = "rsa4096"
+	KeyECDSAP256 = "ecdsa-p256"
+	KeyECDSAP384 = "ecdsa-p384"
+	KeyEd25519   = "ed25519"
+)
+
+// KeyTypes : supported values of Options.KeyType
+var KeyTypes = []string{KeyRSA2048, KeyRSA4096, KeyECDSAP256, KeyECDSAP384, KeyEd25519}
+
+// file permissions: private keys are readable by the owner only
+const (
+	certPerm = 0644
+	keyPerm  = 0600
+	dirPerm  = 0755
+)
+
+// Files : paths of the generated files (same names as [tls] in config.ini)
+type Files struct {
+	CACert     string
+	CAKey      string
+	ServerCert string
+	ServerKey  string
+	ClientCert string
+	ClientKey  string
+}
+
+// DirFiles : default file names in dir (ca.crt, ca.key, server.crt, server.pem, client.crt, client.pem)
+func DirFiles(dir string) Files {
+	return Files{
+		CACert:     filepath.Join(dir, "ca.crt"),
+		CAKey:      filepath.Join(dir, "ca.key"),
+		ServerCert: filepath.Join(dir, "server.crt"),
+		ServerKey:  filepath.Join(dir, "server.pem"),
+		ClientCert: filepath.Join(dir, "client.crt"),
+		ClientKey:  filepath.Join(dir, "client.pem"),
+	}
+}
+
+func (f Files) all() []string {
+	return []string{f.CACert, f.CAKey, f.ServerCert, f.ServerKey, f.ClientCert, f.ClientKey}
+}
+
+// Options : settings of the generated certificates
+type Options struct {
+	Hosts    []string      // subjectAltNames of the server certificate (DNS names or IP addresses)
+	KeyType  string        // one of KeyTypes
+	Validity time.Duration // lifetime of every certificate
+	Force    bool          // overwrite existing files
+}
+
+// DefaultOptions : hosts of docker-compose & local runs, ECDSA P-256 keys valid for 1 year
+func DefaultOptions() Options {
+	return Options{
+		Hosts:    []string{"server", "localhost", "127.0.0.1", "::1"},
+		KeyType:  KeyECDSAP256,
+		Validity: 365 * 24 * time.Hour,
+	}
+}
+
+// Validate : check the options before generating anything
+func (o Options) Validate() error {
+	if len(o.Hosts) == 0 {
+		return errors.New("at least one host is required for the server certificate")
+	}
+	known := false
+	for _, t := range KeyTypes {
+		known = known || t == o.KeyType
+	}
+	if !known {
+		return fmt.Errorf("unknown key type %q (%v)", o.KeyType, strings.Join(KeyTypes, ", "))
+	}
+	if o.Validity <= 0 {
+		return fmt.Errorf("validity must be positive: %v", o.Validity)
+	}
+	return nil
+}
+
+// Init : generate a CA, and server & client certificates signed by it
+// existing files are kept (and an error is returned) unless Options.Force is set
+func Init(files Files, opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if !opts.Force {
+		for _, path := range files.all() {
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%v already exists (use force to overwrite it)", path)
+			}
+		}
+	}
+	now := time.Now()
+
+	caKey, err := newKey(opts.KeyType)
+	if err != nil {
+		return err
+	}
+	caTmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "tipstocks CA"},
+		NotBefore:             now.Add(-time.Hour), // tolerate clock skew
+		NotAfter:              now.Add(opts.Validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	caDER, err := sign(caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		return err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return err
+	}
+
+	serverKey, serverDER, err := issue(serverLeaf(now, opts), ca, caKey, opts.KeyType)
+	if err != nil {
+		return err
+	}
+	clientKey, clientDER, err := issue(leaf("client", now, opts.Validity, x509.ExtKeyUsageClientAuth), ca, caKey, opts.KeyType)
+	if err != nil {
+		return err
+	}
+
+	// keys first: a certificate without its key is useless
+	for _, k := range []struct {
+		path string
+		key  crypto.Signer
+	}{{files.CAKey, caKey}, {files.ServerKey, serverKey}, {files.ClientKey, clientKey}} {
+		if err := writeKey(k.path, k.key); err != nil {
+			return err
+		}
+	}
+	for _, c := range []struct {
+		path string
+		der  []byte
+	}{{files.CACert, caDER}, {files.ServerCert, serverDER}, {files.ClientCert, clientDER}} {
+		if err := writePEM(c.path, "CERTIFICATE", c.der, certPerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ensure : Init unless the server certificate & key already exist ([tls] auto = true)
+// with an existing CA, only the missing server (and client) certificates are issued by it: the CA is never replaced,
+// so that the deployed client certificates keep working; returns whether files were generated
+func Ensure(files Files, opts Options) (bool, error) {
+	if exists(files.ServerCert) && exists(files.ServerKey) {
+		return false, nil
+	}
+	if !exists(files.CACert) && !exists(files.CAKey) {
+		for _, path := range files.all() {
+			if exists(path) {
+				return false, fmt.Errorf("the CA is missing but %v exists: restore the CA or remove the certificates", path)
+			}
+		}
+		if err := Init(files, opts); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err := opts.Validate(); err != nil {
+		return false, err
+	}
+	ca, caKey, err := loadCA(files)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if err := writeLeaf(files.ServerCert, files.ServerKey, serverLeaf(now, opts), ca, caKey, opts.KeyType); err != nil {
+		return false, err
+	}
+	if !exists(files.ClientCert) && !exists(files.ClientKey) {
+		client := leaf("client", now, opts.Validity, x509.ExtKeyUsageClientAuth)
+		if err := writeLeaf(files.ClientCert, files.ClientKey, client, ca, caKey, opts.KeyType); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// loadCA : the CA certificate & its key (PKCS #8, as written by Init)
+func loadCA(files Files) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := ioutil.ReadFile(files.CACert)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read the CA certificate: %v", err)
+	}
+	keyPEM, err := ioutil.ReadFile(files.CAKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read the CA key: %v", err)
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("%v or %v is not PEM", files.CACert, files.CAKey)
+	}
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse the CA certificate: %v", err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse the CA key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok || !ca.IsCA {
+		return nil, nil, fmt.Errorf("%v is not a CA", files.CACert)
+	}
+	return ca, signer, nil
+}
+
+// writeLeaf : a certificate of tmpl issued by ca, and its key
+func writeLeaf(certPath, keyPath string, tmpl, ca *x509.Certificate, caKey crypto.Signer, keyType string) error {
+	key, der, err := issue(tmpl, ca, caKey, keyType)
+	if err != nil {
+		return err
+	}
+	if err := writeKey(keyPath, key); err != nil {
+		return err
+	}
+	return writePEM(certPath, "CERTIFICATE", der, certPerm)
+}
+
+// serverLeaf : template of the server certificate for opts.Hosts
+func serverLeaf(now time.Time, opts Options) *x509.Certificate {
+	tmpl := leaf("server", now, opts.Validity, x509.ExtKeyUsageServerAuth)
+	for _, h := range opts.Hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	return tmpl
+}
+
+func leaf(cn string, now time.Time, validity time.Duration, usage x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn},
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}
+}
+
+func issue(tmpl, ca *x509.Certificate, caKey crypto.Signer, keyType string) (crypto.Signer, []byte, error) {
+	key, err := newKey(keyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := sign(tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, der, nil
+}
+
+func sign(tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	tmpl.SerialNumber = serial
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the certificate %v: %v", tmpl.Subject.CommonName, err)
+	}
+	return der, nil
+}
+
+func newKey(keyType string) (crypto.Signer, error) {
+	switch keyType {
+	case KeyRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unknown key type %q (%v)", keyType, strings.Join(KeyTypes, ", "))
+}
+
+// writeKey : PKCS #8 without password (the format loaded by crypto/tls)
+func writeKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "PRIVATE KEY", der, keyPerm)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm) // WriteFile keeps the mode of an existing file
+}
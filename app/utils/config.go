@@ -1,38 +1,487 @@
 package utils
 
 import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/ini.v1"
 )
 
 // Configs : settings from app/config.ini
+// each field is loaded from the key `conf:"section.key"` with the precedence (lowest first):
+//  1. `default:"..."`
+//  2. config.ini (--config flag, $TIPSTOCKS_CONFIG or DefaultPath)
+//  3. environment variable $TIPSTOCKS_SECTION_KEY (e.g. server.max_timeout -> $TIPSTOCKS_SERVER_MAX_TIMEOUT)
+//  4. --set section.key=value flags
 type Configs struct {
-	ServerPort   int
-	ServerDebug  bool
-	ClientPort   int
-	ClientDebug  bool
-	DBPort       int
-	DBName       string
-	DBCollection string
+	ServerPort             int           `conf:"server.port" default:"50062"`
+	ServerDebug            bool          `conf:"server.debug" default:"false"`
+	ServerMaxTimeout       time.Duration `conf:"server.max_timeout" default:"30s" reload:"true"`
+	ServerDrainTimeout     time.Duration `conf:"server.drain_timeout" default:"10s" reload:"true"`
+	GatewayPort            int           `conf:"gateway.port" default:"50063"`
+	CORSAllowedOrigins     []string      `conf:"cors.allowed_origins"`
+	CORSAllowedHeaders     []string      `conf:"cors.allowed_headers"`
+	ClientPort             int           `conf:"client.port" default:"8081"`
+	ClientDebug            bool          `conf:"client.debug" default:"false"`
+	ClientDrainTimeout     time.Duration `conf:"client.drain_timeout" default:"10s" reload:"true"`
+	ClientRequestTimeout   time.Duration `conf:"client.request_timeout" default:"15s" reload:"true"`
+	ClientRateLimit        float64       `conf:"client.rate_limit" default:"0" reload:"true"` // requests/sec per IP (0: unlimited)
+	ClientRateBurst        int           `conf:"client.rate_burst" default:"10" reload:"true"`
+	ClientTrustedProxies   []string      `conf:"client.trusted_proxies" reload:"true"` // reverse proxies whose X-Forwarded-For is trusted (IPs or CIDR ranges)
+	ScraperUserAgent       string        `conf:"scraper.user_agent" default:"GoScraper" reload:"true"`
+	ScraperTimeout         time.Duration `conf:"scraper.timeout" default:"10s" reload:"true"`
+	ScraperProxy           string        `conf:"scraper.proxy" reload:"true"`                           // $HTTPS_PROXY / $HTTP_PROXY if blank
+	ScraperMaxBodySize     int           `conf:"scraper.max_body_size" default:"2097152" reload:"true"` // bytes of HTML
+	ScraperMaxPDFSize      int           `conf:"scraper.max_pdf_size" default:"20971520" reload:"true"` // 0: PDFs are not downloaded
+	ScraperOEmbed          bool          `conf:"scraper.oembed" default:"true" reload:"true"`
+	ScraperOEmbedProviders string        `conf:"scraper.oembed_providers" reload:"true"` // providers.json of oembed.com (built-in registry if blank)
+	ScraperAllowedHosts    []string      `conf:"scraper.allowed_hosts" reload:"true"`    // private hosts & ranges which may be fetched
+	ScraperCacheDir        string        `conf:"scraper.cache_dir" default:"app/cache/scraper" reload:"true"`
+	ScraperCacheTTL        time.Duration `conf:"scraper.cache_ttl" default:"1h" reload:"true"`           // previews reused without request, then revalidated
+	ScraperCacheMaxEntries int           `conf:"scraper.cache_max_entries" default:"1000" reload:"true"` // 0: no cache
+	LogLevel               string        `conf:"log.level" default:"info" reload:"true"`
+	TLSEnabled             bool          `conf:"tls.enabled" default:"true"`
+	TLSCert                string        `conf:"tls.cert" default:"app/ssl/server.crt"`
+	TLSKey                 string        `conf:"tls.key" default:"app/ssl/server.pem"`
+	TLSCA                  string        `conf:"tls.ca" default:"app/ssl/ca.crt"`
+	TLSServerName          string        `conf:"tls.server_name"` // host of the target if blank
+	TLSClientAuth          bool          `conf:"tls.client_auth" default:"false"`
+	TLSClientCert          string        `conf:"tls.client_cert" default:"app/ssl/client.crt"`
+	TLSClientKey           string        `conf:"tls.client_key" default:"app/ssl/client.pem"`
+	TLSAuto                bool          `conf:"tls.auto" default:"false"` // generate dev certificates on the first start of the server
+	TLSHosts               []string      `conf:"tls.hosts" default:"server, localhost, 127.0.0.1"`
+	AuthEnabled            bool          `conf:"auth.enabled" default:"true"`
+	AuthServiceToken       string        `conf:"auth.service_token"`  // bearer token of the web client (all scopes)
+	AuthSessionSecret      string        `conf:"auth.session_secret"` // key of the session cookies (random per start if blank)
+	AuthSessionTTL         time.Duration `conf:"auth.session_ttl" default:"24h" reload:"true"`
+	AuthCookieSecure       bool          `conf:"auth.cookie_secure" default:"false"` // send the session cookie over HTTPS only
+	AuthAdmins             []string      `conf:"auth.admins" reload:"true"`          // user ids allowed to the /admin pages (nobody if empty)
+	OIDCEnabled            bool          `conf:"oidc.enabled" default:"false"`
+	OIDCIssuer             string        `conf:"oidc.issuer"`
+	OIDCClientID           string        `conf:"oidc.client_id"`
+	OIDCClientSecret       string        `conf:"oidc.client_secret"`
+	OIDCRedirectURL        string        `conf:"oidc.redirect_url"`
+	OIDCAllowedDomains     []string      `conf:"oidc.allowed_domains"` // any domain if empty
+	DBPort                 int           `conf:"db.port" default:"27017"`
+	DBURI                  string        `conf:"db.uri"` // mongodb://mongodb:<db.port> if blank
+	DBName                 string        `conf:"db.name"`
+	DBCollection           string        `conf:"db.collection"`
+	DBTokenCollection      string        `conf:"db.token_collection" default:"tokens"`
+	DBUserCollection       string        `conf:"db.user_collection" default:"users"`
+	DBWorkspaceCollection  string        `conf:"db.workspace_collection" default:"workspaces"`
 }
 
+// DefaultPath : config.ini used without --config flag & $TIPSTOCKS_CONFIG
+const DefaultPath = "app/utils/config.ini"
+
+// EnvPrefix : prefix of the environment variables overriding settings
+const EnvPrefix = "TIPSTOCKS_"
+
 // Conf : contains Configs
 var Conf Configs
 
-// LoadConf : load settings from config.ini
+var (
+	loadedPath string // config file loaded by Setup
+	configFlag = flag.String("config", "", "path of config.ini (default: $TIPSTOCKS_CONFIG or "+DefaultPath+")")
+	setFlags   settingFlags
+)
+
+func init() {
+	flag.Var(&setFlags, "set", "override a setting as section.key=value (repeatable, e.g. --set server.port=50070)")
+}
+
+// settingFlags : values of the repeatable --set flag
+type settingFlags []string
+
+func (f *settingFlags) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *settingFlags) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("expected section.key=value: %v", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+// Setup : load & validate settings of the binaries (call after flag.Parse)
+func Setup() (Configs, error) {
+	path := *configFlag
+	if path == "" {
+		path = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if path == "" {
+		path = DefaultPath
+	}
+	loadedPath = path
+	conf, err := Load(path, setFlags)
+	if err != nil {
+		return conf, err
+	}
+	return conf, conf.Validate()
+}
+
+// LoadConf : load settings from config.ini (& environment variables)
 func LoadConf(path string) Configs {
-	cfg, cfgErr := ini.Load(path)
-	if cfgErr != nil {
-		log.Fatalln("Cannot load config.ini: ", cfgErr)
-	}
-	return Configs{
-		ServerPort:   cfg.Section("server").Key("port").MustInt(50051),
-		ServerDebug:  cfg.Section("server").Key("debug").MustBool(true),
-		ClientPort:   cfg.Section("client").Key("port").MustInt(8000),
-		ClientDebug:  cfg.Section("client").Key("debug").MustBool(true),
-		DBPort:       cfg.Section("db").Key("port").MustInt(27017),
-		DBName:       cfg.Section("db").Key("name").String(),
-		DBCollection: cfg.Section("db").Key("collection").String(),
+	conf, err := Load(path, nil)
+	if err != nil {
+		log.Fatalln("Cannot load config.ini: ", err)
+	}
+	return conf
+}
+
+// Load : load settings from defaults, config.ini, environment variables & overrides (section.key=value) in this order
+func Load(path string, overrides []string) (Configs, error) {
+	conf := Configs{}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return conf, err
+	}
+	given := map[string]string{}
+	for _, o := range overrides {
+		kv := strings.SplitN(o, "=", 2)
+		if len(kv) != 2 {
+			return conf, fmt.Errorf("expected section.key=value: %v", o)
+		}
+		given[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	v := reflect.ValueOf(&conf).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("conf")
+		sectionKey := strings.SplitN(name, ".", 2)
+		section, key := sectionKey[0], sectionKey[1]
+
+		raw, from := field.Tag.Get("default"), "default"
+		if cfg.Section(section).HasKey(key) {
+			raw, from = cfg.Section(section).Key(key).String(), path
+		}
+		if env := EnvName(name); os.Getenv(env) != "" {
+			raw, from = os.Getenv(env), "$"+env
+		}
+		if value, ok := given[name]; ok {
+			raw, from = value, "--set"
+		}
+		delete(given, name)
+		if err := setField(v.Field(i), raw); err != nil {
+			return conf, fmt.Errorf("invalid value of %v (from %v): %v", name, from, err)
+		}
+	}
+	if len(given) > 0 {
+		unknown := []string{}
+		for name := range given {
+			unknown = append(unknown, name)
+		}
+		return conf, fmt.Errorf("unknown settings: %v", strings.Join(unknown, ", "))
+	}
+	if conf.DBURI == "" {
+		conf.DBURI = fmt.Sprintf("mongodb://mongodb:%v", conf.DBPort)
+	}
+	return conf, nil
+}
+
+// EnvName : environment variable of a setting (e.g. server.port -> TIPSTOCKS_SERVER_PORT)
+func EnvName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, ".", "_"))
+}
+
+func setField(f reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch f.Interface().(type) {
+	case time.Duration:
+		if raw == "" {
+			return nil
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case int:
+		if raw == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case bool:
+		if raw == "" {
+			return nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case float64:
+		if raw == "" {
+			return nil
+		}
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case string:
+		f.SetString(raw)
+	case []string:
+		list := []string{}
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type: %v", f.Type())
+	}
+	return nil
+}
+
+// Validate : check the settings before starting the binaries (all problems are reported at once)
+func (conf Configs) Validate() error {
+	problems := []string{}
+	ports := []struct {
+		name string
+		port int
+	}{
+		{"server.port", conf.ServerPort},
+		{"gateway.port", conf.GatewayPort},
+		{"client.port", conf.ClientPort},
+		{"db.port", conf.DBPort},
+	}
+	for _, p := range ports {
+		if p.port < 1 || p.port > 65535 {
+			problems = append(problems, fmt.Sprintf("%v must be in 1-65535: %v", p.name, p.port))
+		}
+	}
+	if conf.ServerPort == conf.GatewayPort {
+		problems = append(problems, fmt.Sprintf("server.port and gateway.port must be different: %v", conf.ServerPort))
+	}
+	if conf.DBName == "" {
+		problems = append(problems, "db.name is required")
+	} else if strings.ContainsAny(conf.DBName, `/\. "$`) {
+		problems = append(problems, fmt.Sprintf("db.name must not contain /\\. \"$: %v", conf.DBName))
+	}
+	collections := []struct {
+		name string
+		c    string
+	}{
+		{"db.collection", conf.DBCollection},
+		{"db.token_collection", conf.DBTokenCollection},
+		{"db.user_collection", conf.DBUserCollection},
+		{"db.workspace_collection", conf.DBWorkspaceCollection},
+	}
+	usedBy := map[string]string{}
+	for _, c := range collections {
+		if c.c == "" {
+			problems = append(problems, fmt.Sprintf("%v is required", c.name))
+		} else if strings.HasPrefix(c.c, "system.") || strings.Contains(c.c, "$") {
+			problems = append(problems, fmt.Sprintf("%v must not start with system. or contain $: %v", c.name, c.c))
+		} else if other, ok := usedBy[c.c]; ok {
+			problems = append(problems, fmt.Sprintf("%v and %v must be different: %v", other, c.name, c.c))
+		}
+		usedBy[c.c] = c.name
 	}
+	if !strings.HasPrefix(conf.DBURI, "mongodb://") && !strings.HasPrefix(conf.DBURI, "mongodb+srv://") {
+		problems = append(problems, "db.uri must start with mongodb:// or mongodb+srv://")
+	}
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"server.max_timeout", conf.ServerMaxTimeout},
+		{"server.drain_timeout", conf.ServerDrainTimeout},
+		{"client.drain_timeout", conf.ClientDrainTimeout},
+		{"client.request_timeout", conf.ClientRequestTimeout},
+		{"auth.session_ttl", conf.AuthSessionTTL},
+		{"scraper.timeout", conf.ScraperTimeout},
+	}
+	for _, d := range durations {
+		if d.d <= 0 {
+			problems = append(problems, fmt.Sprintf("%v must be positive: %v", d.name, d.d))
+		}
+	}
+	if conf.ClientRateLimit < 0 || conf.ClientRateBurst < 1 {
+		problems = append(problems, fmt.Sprintf("client.rate_limit must not be negative & client.rate_burst must be positive: %v, %v", conf.ClientRateLimit, conf.ClientRateBurst))
+	}
+	if _, err := ParsePrefixes(conf.ClientTrustedProxies); err != nil {
+		problems = append(problems, fmt.Sprintf("client.trusted_proxies must be IP addresses or CIDR ranges: %v", err))
+	}
+	for _, admin := range conf.AuthAdmins {
+		if !isUserID(strings.TrimSpace(admin)) {
+			problems = append(problems, fmt.Sprintf("auth.admins must be user ids (not usernames, which anyone may claim): %q", admin))
+		}
+	}
+	if conf.ScraperCacheTTL < 0 || conf.ScraperCacheMaxEntries < 0 {
+		problems = append(problems, fmt.Sprintf("scraper.cache_ttl & scraper.cache_max_entries must not be negative: %v, %v", conf.ScraperCacheTTL, conf.ScraperCacheMaxEntries))
+	}
+	if conf.ScraperCacheMaxEntries > 0 && conf.ScraperCacheDir == "" {
+		problems = append(problems, "scraper.cache_dir is required with scraper.cache_max_entries")
+	}
+	if conf.ScraperUserAgent == "" {
+		problems = append(problems, "scraper.user_agent is required")
+	}
+	if conf.ScraperMaxBodySize < 1 {
+		problems = append(problems, fmt.Sprintf("scraper.max_body_size must be positive: %v", conf.ScraperMaxBodySize))
+	}
+	if conf.ScraperMaxPDFSize < 0 {
+		problems = append(problems, fmt.Sprintf("scraper.max_pdf_size must not be negative: %v", conf.ScraperMaxPDFSize))
+	}
+	if conf.ScraperProxy != "" {
+		if parsed, err := url.Parse(conf.ScraperProxy); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("scraper.proxy must be a URL (e.g. http://proxy:3128): %q", conf.ScraperProxy))
+		}
+	}
+	if conf.ScraperOEmbedProviders != "" {
+		if _, err := loadOEmbedProviders(conf.ScraperOEmbedProviders); err != nil {
+			problems = append(problems, fmt.Sprintf("scraper.oembed_providers must be a providers.json file: %v", err))
+		}
+	}
+	if _, err := goscraper.NewGuard(conf.ScraperAllowedHosts); err != nil {
+		problems = append(problems, fmt.Sprintf("scraper.allowed_hosts must be host names, IP addresses or CIDR ranges: %v", err))
+	}
+	if conf.LogLevel != LevelDebug && conf.LogLevel != LevelInfo {
+		problems = append(problems, fmt.Sprintf("log.level must be %v or %v: %v", LevelDebug, LevelInfo, conf.LogLevel))
+	}
+	if conf.AuthEnabled && len(conf.AuthServiceToken) < 32 {
+		problems = append(problems, fmt.Sprintf("auth.service_token must be at least 32 characters while auth.enabled = true (set %v)", EnvName("auth.service_token")))
+	}
+	if conf.AuthSessionSecret != "" && len(conf.AuthSessionSecret) < 32 {
+		problems = append(problems, "auth.session_secret must be at least 32 characters")
+	}
+	if conf.OIDCEnabled {
+		for _, u := range [][2]string{{"oidc.issuer", conf.OIDCIssuer}, {"oidc.redirect_url", conf.OIDCRedirectURL}} {
+			if parsed, err := url.Parse(u[1]); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+				problems = append(problems, fmt.Sprintf("%v must be an http(s) URL while oidc.enabled = true: %q", u[0], u[1]))
+			}
+		}
+		if conf.OIDCClientID == "" {
+			problems = append(problems, "oidc.client_id is required while oidc.enabled = true")
+		}
+	}
+	if conf.TLSEnabled {
+		files := [][2]string{{"tls.cert", conf.TLSCert}, {"tls.key", conf.TLSKey}, {"tls.ca", conf.TLSCA}}
+		if conf.TLSClientAuth {
+			files = append(files, [2]string{"tls.client_cert", conf.TLSClientCert}, [2]string{"tls.client_key", conf.TLSClientKey})
+		}
+		for _, f := range files {
+			if f[1] == "" {
+				problems = append(problems, fmt.Sprintf("%v is required while tls.enabled = true", f[0]))
+			} else if _, err := os.Stat(f[1]); err != nil && !conf.TLSAuto {
+				problems = append(problems, fmt.Sprintf("%v is not readable (generate it by `tipstocks certs init`, set tls.auto = true or tls.enabled = false): %v", f[0], err))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// Setting : a setting for displaying
+type Setting struct {
+	Name       string // section.key
+	Env        string
+	Value      string
+	Reloadable bool
+}
+
+// Settings : all the settings in the order of Configs (credentials are redacted)
+func (conf Configs) Settings() []Setting {
+	settings := []Setting{}
+	v := reflect.ValueOf(conf)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("conf")
+		settings = append(settings, Setting{
+			Name:       name,
+			Env:        EnvName(name),
+			Value:      Redact(name, v.Field(i).Interface()),
+			Reloadable: t.Field(i).Tag.Get("reload") == "true",
+		})
+	}
+	return settings
+}
+
+// Redact : string of a setting without credentials (e.g. the password in db.uri, tokens & secrets)
+func Redact(name string, value interface{}) string {
+	if name == "db.uri" {
+		u, err := url.Parse(fmt.Sprint(value))
+		if err != nil {
+			return "(invalid URI)"
+		}
+		if u.User != nil {
+			u.User = url.User("***")
+		}
+		return u.String()
+	}
+	if name == "auth.service_token" || name == "auth.session_secret" || name == "oidc.client_secret" {
+		if fmt.Sprint(value) == "" {
+			return ""
+		}
+		return "***"
+	}
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// ParsePrefixes : CIDR ranges of IP addresses or ranges (e.g. "10.0.0.1" or "172.16.0.0/12")
+func ParsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := []netip.Prefix{}
+	for _, v := range list {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// IsAdmin : the user of userID is in [auth] admins
+// admins are configured by id: usernames can be claimed by anyone signing up (or signing in with SSO) first
+func (conf Configs) IsAdmin(userID string) bool {
+	for _, admin := range conf.AuthAdmins {
+		if userID != "" && strings.TrimSpace(admin) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// isUserID : hex of a MongoDB ObjectID (24 characters)
+func isUserID(s string) bool {
+	_, err := hex.DecodeString(s)
+	return len(s) == 24 && err == nil
 }
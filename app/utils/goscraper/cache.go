@@ -0,0 +1,288 @@
+package goscraper
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedPreview : a scraped document kept with the validators of its response
+type CachedPreview struct {
+	Key           string // NormalizeURL of the scraped url
+	ETag          string // sent as If-None-Match to revalidate the preview
+	LastModified  string // sent as If-Modified-Since
+	StatusCode    int
+	ContentType   string
+	ContentLength int64
+	Preview       DocumentPreview
+	StoredAt      time.Time // fetched or revalidated
+	UsedAt        time.Time
+}
+
+// Cache : storage of the previews by NormalizeURL
+type Cache interface {
+	Get(key string) (*CachedPreview, bool)
+	Put(entry *CachedPreview)
+}
+
+// fresh : the preview is reused without request
+func (e *CachedPreview) fresh(ttl time.Duration) bool {
+	return time.Since(e.StoredAt) < ttl
+}
+
+// revalidatable : the preview can be reused after a 304 response to a conditional request
+func (e *CachedPreview) revalidatable() bool {
+	return e.ETag != "" || e.LastModified != ""
+}
+
+func (e *CachedPreview) document() *Document {
+	return &Document{
+		StatusCode:    e.StatusCode,
+		ContentType:   e.ContentType,
+		ContentLength: e.ContentLength,
+		Preview:       e.Preview,
+		Cached:        true,
+	}
+}
+
+// NormalizeURL : key of the previews of u (scheme & host in lower case, no default port, no fragment
+// except "#!", sorted query without the utm_* tracking parameters)
+func NormalizeURL(u *url.URL) string {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	host := strings.ToLower(n.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port := n.Port(); port != "" && !(port == "80" && n.Scheme == "http") && !(port == "443" && n.Scheme == "https") {
+		host += ":" + port
+	}
+	n.Host = host
+	n.User = nil
+	if n.Path == "" {
+		n.Path = "/"
+	}
+	if !strings.HasPrefix(n.Fragment, "!") { // AJAX crawling fragments are other pages
+		n.Fragment, n.RawFragment = "", ""
+	}
+	query := n.Query()
+	for k := range query {
+		if strings.HasPrefix(strings.ToLower(k), "utm_") {
+			query.Del(k)
+		}
+	}
+	n.RawQuery = query.Encode() // sorted by key
+	n.ForceQuery = false
+	return n.String()
+}
+
+// DiskCache : Cache of JSON files in a directory, the least recently used ones are removed beyond its size
+// the uses are kept in memory: Flush saves them for the order of the next start
+type DiskCache struct {
+	mu         sync.Mutex
+	dir        string
+	maxEntries int
+	order      *list.List // of *cacheItem, the most recently used first
+	entries    map[string]*list.Element
+}
+
+// cacheItem : an entry in the order of use
+type cacheItem struct {
+	key    string
+	usedAt time.Time
+	dirty  bool // usedAt is not written yet
+}
+
+// NewDiskCache : cache of maxEntries previews at most in dir (the entries already in dir are kept)
+func NewDiskCache(dir string, maxEntries int) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	c := &DiskCache{dir: dir, maxEntries: maxEntries, order: list.New(), entries: map[string]*list.Element{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	loaded := []*CachedPreview{}
+	for _, f := range files {
+		e, err := readEntry(f)
+		if err != nil || cacheFile(dir, e.Key) != f {
+			os.Remove(f) // broken
+			continue
+		}
+		loaded = append(loaded, e)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].UsedAt.After(loaded[j].UsedAt) })
+	for _, e := range loaded {
+		c.entries[e.Key] = c.order.PushBack(&cacheItem{key: e.Key, usedAt: e.UsedAt})
+	}
+	c.evict()
+	return c, nil
+}
+
+func cacheFile(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func readEntry(file string) (*CachedPreview, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	e := &CachedPreview{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (c *DiskCache) write(e *CachedPreview) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file := cacheFile(c.dir, e.Key)
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file) // never half-written
+}
+
+// Dir : directory of the files
+func (c *DiskCache) Dir() string {
+	return c.dir
+}
+
+// SetMaxEntries : the least recently used entries are removed beyond n
+func (c *DiskCache) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntries = n
+	c.evict()
+}
+
+func (c *DiskCache) evict() {
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back().Value.(*cacheItem).key)
+	}
+}
+
+func (c *DiskCache) remove(key string) {
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	os.Remove(cacheFile(c.dir, key))
+}
+
+func (c *DiskCache) Get(key string) (*CachedPreview, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e, err := readEntry(cacheFile(c.dir, key))
+	if err != nil || e.Key != key {
+		c.remove(key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	item := el.Value.(*cacheItem)
+	item.usedAt, item.dirty = time.Now(), true
+	e.UsedAt = item.usedAt
+	return e, true
+}
+
+// Put : e is written (and removed from the cache if it cannot be written)
+func (c *DiskCache) Put(e *CachedPreview) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxEntries <= 0 {
+		return
+	}
+	e.UsedAt = time.Now()
+	if err := c.write(e); err != nil {
+		c.remove(e.Key)
+		return
+	}
+	item := &cacheItem{key: e.Key, usedAt: e.UsedAt}
+	if el, ok := c.entries[e.Key]; ok {
+		el.Value = item
+		c.order.MoveToFront(el)
+	} else {
+		c.entries[e.Key] = c.order.PushFront(item)
+	}
+	c.evict()
+}
+
+// Flush : the times of use since the last Put are written, for the order of the next start
+func (c *DiskCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		item := el.Value.(*cacheItem)
+		if !item.dirty {
+			continue
+		}
+		e, err := readEntry(cacheFile(c.dir, item.key))
+		if err == nil {
+			e.UsedAt = item.usedAt
+			err = c.write(e)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		item.dirty = false
+	}
+	return firstErr
+}
+
+// Entries : the cached previews, the most recently used first
+func (c *DiskCache) Entries() []*CachedPreview {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := []*CachedPreview{}
+	for el := c.order.Front(); el != nil; el = el.Next() {
+		item := el.Value.(*cacheItem)
+		if e, err := readEntry(cacheFile(c.dir, item.key)); err == nil {
+			e.UsedAt = item.usedAt
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Delete : the entry of key is removed (false if there was none)
+func (c *DiskCache) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	c.remove(key)
+	return ok
+}
+
+// Purge : every entry is removed, returns how many
+func (c *DiskCache) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.order.Len()
+	for key := range c.entries {
+		c.remove(key)
+	}
+	return n
+}
@@ -0,0 +1,225 @@
+package goscraper
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// Extractor : site-specific enrichment of the previews of the pages it matches
+// (e.g. the language of a repository or whether a question has an accepted answer)
+type Extractor interface {
+	Name() string
+	Match(u *url.URL) bool
+	// Extract : fill p from the HTML read for the preview (the whole page up to Options.MaxBodySize)
+	Extract(u *url.URL, root *html.Node, p *DocumentPreview)
+}
+
+// ExtractFunc : Extract of an Extractor made by NewExtractor
+type ExtractFunc func(u *url.URL, root *html.Node, p *DocumentPreview)
+
+var extractors struct {
+	sync.RWMutex
+	list []Extractor
+}
+
+// RegisterExtractor : e is used for the pages it matches, before the extractors registered earlier
+// (the built-in ones can be overridden)
+func RegisterExtractor(e Extractor) {
+	extractors.Lock()
+	defer extractors.Unlock()
+	extractors.list = append([]Extractor{e}, extractors.list...)
+}
+
+// findExtractor : the extractor of u (nil if none matches)
+func findExtractor(u *url.URL) Extractor {
+	extractors.RLock()
+	defer extractors.RUnlock()
+	for _, e := range extractors.list {
+		if e.Match(u) {
+			return e
+		}
+	}
+	return nil
+}
+
+// extract : preview of doc enriched by the extractor of u
+func extract(u *url.URL, doc *Document) {
+	e := findExtractor(u)
+	if e == nil || doc.Body.Len() == 0 {
+		return
+	}
+	root, err := html.Parse(bytes.NewReader(doc.Body.Bytes()))
+	if err != nil {
+		return
+	}
+	if doc.Preview.Fields == nil {
+		doc.Preview.Fields = map[string]string{}
+	}
+	e.Extract(u, root, &doc.Preview)
+	doc.Preview.Extractor = e.Name()
+}
+
+// patternExtractor : extractor of the pages matching host/path patterns
+type patternExtractor struct {
+	name     string
+	patterns []string
+	extract  ExtractFunc
+}
+
+// NewExtractor : extractor of the urls matching one of patterns
+// a pattern is host + path with the syntax of path.Match, e.g. "github.com/*/*" or "*.stackexchange.com/questions/*/*"
+// ("*." also matches the bare domain, and a trailing "/**" matches any deeper path)
+func NewExtractor(name string, patterns []string, fn ExtractFunc) Extractor {
+	return &patternExtractor{name: name, patterns: patterns, extract: fn}
+}
+
+func (e *patternExtractor) Name() string {
+	return e.name
+}
+
+func (e *patternExtractor) Match(u *url.URL) bool {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	p := strings.TrimSuffix(u.EscapedPath(), "/")
+	for _, pattern := range e.patterns {
+		i := strings.Index(pattern, "/")
+		if i < 0 {
+			i = len(pattern)
+		}
+		hostPattern, pathPattern := pattern[:i], pattern[i:]
+		if !matchHost(hostPattern, host) {
+			continue
+		}
+		if strings.HasSuffix(pathPattern, "/**") {
+			prefix := strings.TrimSuffix(pathPattern, "/**")
+			if prefix == "" {
+				return true
+			}
+			if ok, _ := path.Match(prefix, p); ok {
+				return true
+			}
+			for dir := p; dir != "/" && dir != "." && dir != ""; dir = path.Dir(dir) {
+				if ok, _ := path.Match(prefix, dir); ok {
+					return true
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(pathPattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *patternExtractor) Extract(u *url.URL, root *html.Node, p *DocumentPreview) {
+	e.extract(u, root, p)
+}
+
+func matchHost(pattern, host string) bool {
+	pattern = strings.TrimPrefix(strings.ToLower(pattern), "www.")
+	if strings.HasPrefix(pattern, "*.") && host == pattern[2:] {
+		return true
+	}
+	ok, _ := path.Match(pattern, host)
+	return ok
+}
+
+// ----- helpers of the extractors ----- //
+
+// findAll : the elements under n for which match is true, in document order
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	found := []*html.Node{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && match(n) {
+			found = append(found, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return found
+}
+
+// find : the first element under n for which match is true (nil if none)
+func find(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	if n == nil {
+		return ""
+	}
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// text : the text of n with the whitespaces collapsed
+func text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	b := &strings.Builder{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// byTag : element matcher of a tag & optionally an attribute with a value (or containing the class)
+func byTag(tag, key, val string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		if n.Data != tag && tag != "*" {
+			return false
+		}
+		if key == "" {
+			return true
+		}
+		if key == "class" {
+			for _, c := range strings.Fields(attr(n, "class")) {
+				if c == val {
+					return true
+				}
+			}
+			return false
+		}
+		return attr(n, key) == val
+	}
+}
+
+// metaContents : the contents of the <meta name=...> of name
+func metaContents(root *html.Node, name string) []string {
+	contents := []string{}
+	for _, n := range findAll(root, byTag("meta", "name", name)) {
+		if c := strings.TrimSpace(attr(n, "content")); c != "" {
+			contents = append(contents, c)
+		}
+	}
+	return contents
+}
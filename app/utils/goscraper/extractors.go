@@ -0,0 +1,185 @@
+package goscraper
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// built-in extractors (the fields are only set when found in the page)
+//   - repository: owner/name, language, stars (GitHub, GitLab)
+//   - package: registry, package, version (pkg.go.dev, npm, PyPI)
+//   - question: answers, score, answered ("accepted" or "no") & the tags as keywords (Stack Exchange sites)
+//   - rfc: number, status & the authors (RFC Editor, IETF Datatracker)
+func init() {
+	RegisterExtractor(NewExtractor("rfc", []string{
+		"rfc-editor.org/rfc/*", "rfc-editor.org/info/*", "datatracker.ietf.org/doc/html/*", "datatracker.ietf.org/doc/*",
+	}, extractRFC))
+	RegisterExtractor(NewExtractor("question", []string{
+		"stackoverflow.com/questions/*/**", "*.stackexchange.com/questions/*/**", "superuser.com/questions/*/**",
+		"serverfault.com/questions/*/**", "askubuntu.com/questions/*/**", "mathoverflow.net/questions/*/**",
+	}, extractQuestion))
+	RegisterExtractor(NewExtractor("package", []string{
+		"pkg.go.dev/**", "npmjs.com/package/**", "pypi.org/project/*",
+	}, extractPackage))
+	RegisterExtractor(NewExtractor("repository", []string{
+		"github.com/*/*", "gitlab.com/*/*",
+	}, extractRepository))
+}
+
+var (
+	githubBoilerplate = regexp.MustCompile(`\s*(-\s*)?Contribute to \S+ development by creating an account on GitHub\.?$`)
+	siteSuffix        = regexp.MustCompile(`\s+[-|]\s+(Stack Overflow|Super User|Server Fault|Ask Ubuntu|MathOverflow|[^-|]+ Stack Exchange)$`)
+	rfcNumber         = regexp.MustCompile(`(?i)^rfc0*(\d+)(\.html|\.txt|\.pdf)?$`)
+	// e.g. "Category: Standards Track" or "Status: INFORMATIONAL" in the header of the RFCs
+	rfcStatus = regexp.MustCompile(`(?i)(?:Category|Status):\s*(Standards Track|Informational|Experimental|Best Current Practice|Historic|Proposed Standard|Internet Standard|Draft Standard)`)
+	nonDigits = regexp.MustCompile(`[^0-9]`)
+)
+
+// reservedOwners : paths of GitHub & GitLab which are not repositories
+var reservedOwners = map[string]bool{
+	"features": true, "topics": true, "orgs": true, "settings": true, "marketplace": true, "explore": true,
+	"sponsors": true, "collections": true, "trending": true, "about": true, "pricing": true, "users": true,
+}
+
+func extractRepository(u *url.URL, root *html.Node, p *DocumentPreview) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 || reservedOwners[strings.ToLower(parts[0])] {
+		return
+	}
+	p.Fields["repository"] = parts[0] + "/" + parts[1]
+	p.Type = "repository"
+	p.Description = strings.TrimSpace(githubBoilerplate.ReplaceAllString(p.Description, ""))
+
+	// "Languages" of the sidebar: the first one is the main language
+	language := text(find(root, byTag("*", "itemprop", "programmingLanguage")))
+	if language == "" {
+		if h := find(root, func(n *html.Node) bool { return n.Data == "h2" && text(n) == "Languages" }); h != nil && h.Parent != nil {
+			language = text(find(h.Parent, byTag("span", "class", "text-bold")))
+		}
+	}
+	if language != "" {
+		p.Fields["language"] = language
+	}
+	if stars := find(root, byTag("*", "id", "repo-stars-counter-star")); stars != nil {
+		if n := nonDigits.ReplaceAllString(attr(stars, "title"), ""); n != "" {
+			p.Fields["stars"] = n
+		} else if t := text(stars); t != "" {
+			p.Fields["stars"] = t
+		}
+	}
+}
+
+func extractPackage(u *url.URL, root *html.Node, p *DocumentPreview) {
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	p.Type = "package"
+	switch host {
+	case "pkg.go.dev":
+		name := strings.Trim(u.Path, "/")
+		if i := strings.Index(name, "@"); i >= 0 {
+			p.Fields["version"] = name[i+1:]
+			name = name[:i]
+		}
+		p.Fields["registry"] = "Go"
+		p.Fields["package"] = name
+		if v := find(root, byTag("*", "data-test-id", "UnitHeader-version")); v != nil {
+			p.Fields["version"] = strings.TrimSpace(strings.TrimPrefix(text(v), "Version:"))
+		}
+	case "npmjs.com":
+		name := strings.TrimPrefix(strings.Trim(u.Path, "/"), "package/")
+		if i := strings.Index(name, "/v/"); i >= 0 {
+			p.Fields["version"] = name[i+3:]
+			name = name[:i]
+		}
+		p.Fields["registry"] = "npm"
+		p.Fields["package"] = name
+		// "1.2.3 • Public • Published 2 days ago" under the name
+		for _, span := range findAll(root, byTag("span", "", "")) {
+			if t := text(span); strings.Contains(t, "• Public") {
+				p.Fields["version"] = strings.TrimSpace(strings.Split(t, "•")[0])
+				break
+			}
+		}
+	case "pypi.org":
+		p.Fields["registry"] = "PyPI"
+		p.Fields["package"] = strings.TrimPrefix(strings.Trim(u.Path, "/"), "project/")
+		if h := find(root, byTag("h1", "class", "package-header__name")); h != nil {
+			if fields := strings.Fields(text(h)); len(fields) > 1 {
+				p.Fields["version"] = fields[len(fields)-1]
+			}
+		}
+		if s := text(find(root, byTag("p", "class", "package-description__summary"))); s != "" {
+			p.Description = s
+		}
+	}
+}
+
+func extractQuestion(u *url.URL, root *html.Node, p *DocumentPreview) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return
+	}
+	if _, err := strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return // e.g. /questions/tagged/go
+	}
+	p.Type = "question"
+	p.Title = siteSuffix.ReplaceAllString(p.Title, "")
+	question := find(root, byTag("*", "id", "question"))
+	if question == nil {
+		question = root
+	}
+	if score := find(question, byTag("*", "itemprop", "upvoteCount")); score != nil {
+		if s := strings.TrimSpace(attr(score, "data-value")); s != "" {
+			p.Fields["score"] = s
+		} else {
+			p.Fields["score"] = text(score)
+		}
+	}
+	if answers := find(root, byTag("*", "itemprop", "answerCount")); answers != nil {
+		p.Fields["answers"] = text(answers)
+	} else {
+		p.Fields["answers"] = nonDigits.ReplaceAllString(text(find(root, byTag("*", "id", "answers-header"))), "")
+	}
+	p.Fields["answered"] = "no"
+	if find(root, byTag("*", "itemprop", "acceptedAnswer")) != nil || find(root, byTag("*", "class", "accepted-answer")) != nil {
+		p.Fields["answered"] = "accepted"
+	}
+	tags := []string{}
+	for _, tag := range findAll(question, byTag("a", "class", "post-tag")) {
+		if t := text(tag); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) > 0 {
+		p.Keywords = tags
+	}
+}
+
+func extractRFC(u *url.URL, root *html.Node, p *DocumentPreview) {
+	name := u.Path[strings.LastIndex(strings.TrimSuffix(u.Path, "/"), "/")+1:]
+	m := rfcNumber.FindStringSubmatch(strings.TrimSuffix(name, "/"))
+	if m == nil { // e.g. a draft on the datatracker
+		return
+	}
+	p.Type = "rfc"
+	p.Fields["number"] = m[1]
+	if authors := metaContents(root, "citation_author"); len(authors) > 0 {
+		p.Author = strings.Join(authors, ", ")
+	} else if authors := metaContents(root, "dcterms.creator"); len(authors) > 0 {
+		p.Author = strings.Join(authors, ", ")
+	}
+	if date := metaContents(root, "citation_publication_date"); len(date) > 0 {
+		p.PublishedTime = date[0]
+	} else if date := metaContents(root, "dcterms.issued"); len(date) > 0 {
+		p.PublishedTime = date[0]
+	}
+	if title := metaContents(root, "citation_title"); len(title) > 0 {
+		p.Title = "RFC " + m[1] + ": " + title[0]
+	}
+	if s := rfcStatus.FindStringSubmatch(text(root)); s != nil {
+		p.Fields["status"] = s[1]
+	}
+}
@@ -27,16 +27,23 @@ SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE
 package goscraper
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"mime"
+	"myTips/tipstocks/app/utils/goscraper/pdf"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
 )
 
 var (
@@ -44,43 +51,197 @@ var (
 	fragmentRegexp         = regexp.MustCompile("#!(.*)")
 )
 
+const (
+	DefaultUserAgent   = "GoScraper"
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxBodySize = 2 << 20  // bytes of HTML read at most (the preview is usually in <head>)
+	DefaultMaxPDFSize  = 20 << 20 // bytes of PDF documents downloaded for their metadata
+)
+
+// Options : how ScrapeContext fetches the pages
+type Options struct {
+	Client      *http.Client  // http.DefaultClient if nil
+	Timeout     time.Duration // limit of each request including the body (DefaultTimeout if 0, none if negative)
+	UserAgent   string        // DefaultUserAgent if blank
+	Headers     http.Header   // extra request headers (e.g. Accept-Language)
+	Proxy       *url.URL      // proxy of the requests (the proxy of Client, e.g. $HTTPS_PROXY, if nil)
+	MaxRedirect int           // refetches by <link rel="canonical"> & AJAX crawling fragments
+	MaxBodySize int64         // DefaultMaxBodySize if 0, no limit if negative (only HTML bodies are read)
+	MaxPDFSize  int64         // DefaultMaxPDFSize if 0, PDFs are not downloaded if negative
+	Guard       *Guard        // every address is fetched if nil
+	Cache       Cache         // previews are always fetched if nil
+	CacheTTL    time.Duration // cached previews are reused without request for CacheTTL, then revalidated by conditional requests
+
+	OEmbedProviders []OEmbedProvider // DefaultOEmbedProviders if nil (discovery only if empty)
+	DisableOEmbed   bool             // neither discovery nor providers
+}
+
 type Scraper struct {
 	Url                *url.URL
 	EscapedFragmentUrl *url.URL
 	MaxRedirect        int
+	UserAgent          string        // DefaultUserAgent if blank
+	Client             *http.Client  // http.DefaultClient if nil
+	Timeout            time.Duration // DefaultTimeout if 0, none if negative
+	Headers            http.Header
+	MaxBodySize        int64            // DefaultMaxBodySize if 0, no limit if negative
+	MaxPDFSize         int64            // DefaultMaxPDFSize if 0, PDFs are not downloaded if negative
+	OEmbedProviders    []OEmbedProvider // DefaultOEmbedProviders if nil
+	DisableOEmbed      bool
+	Cache              Cache // by NormalizeURL of Url
+	CacheTTL           time.Duration
+
+	conditional *CachedPreview // validators of the next request
 }
 
 type Document struct {
-	Body    bytes.Buffer
-	Preview DocumentPreview
+	Body          bytes.Buffer // the part of the HTML read for the preview
+	StatusCode    int          // of the last response
+	ContentType   string       // media type of the last response (e.g. "text/html")
+	ContentLength int64        // -1 if unknown
+	Preview       DocumentPreview
+	Cached        bool // the preview was reused from Options.Cache (the Body is empty)
+
+	body         io.ReadCloser // HTML to be parsed (nil for the other types)
+	oembedUrl    string        // discovered in the HTML
+	etag         string        // validators of the last response
+	lastModified string
 }
 
 type DocumentPreview struct {
-	Icon        string
-	Name        string
-	Title       string
-	Description string
-	Images      []string
-	Link        string
+	Icon          string
+	Name          string
+	Title         string
+	Description   string
+	Images        []string // the urls of ImageCandidates
+	Link          string
+	Author        string
+	Pages         int      // of PDF documents (0 if unknown)
+	PublishedTime string   // as found in the page (usually ISO 8601)
+	Keywords      []string // e.g. <meta name="keywords"> or article:tag
+	Type          string   // e.g. "article" (og:type) or "NewsArticle" (schema.org)
+	Locale        string   // e.g. "en_US" (og:locale) or "en" (<html lang>)
+
+	ImageCandidates []ImageCandidate  // the best first
+	OEmbed          *OEmbed           // nil if the page has no oEmbed provider
+	Extractor       string            // name of the Extractor which enriched the preview ("" if none)
+	Fields          map[string]string // site-specific fields set by the Extractor (e.g. "language" of a repository)
 }
 
 func Scrape(uri string, maxRedirect int) (*Document, error) {
+	return ScrapeContext(context.Background(), uri, Options{MaxRedirect: maxRedirect})
+}
+
+// ScrapeContext : preview of uri, canceled with ctx
+func ScrapeContext(ctx context.Context, uri string, opts Options) (*Document, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
 	}
-	return (&Scraper{Url: u, MaxRedirect: maxRedirect}).Scrape()
+	if opts.Guard != nil {
+		if err := opts.Guard.CheckURL(ctx, u); err != nil {
+			return nil, err
+		}
+	}
+	client, err := clientWithProxy(opts.Client, opts.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	client, err = guardClient(client, opts.Guard)
+	if err != nil {
+		return nil, err
+	}
+	scraper := &Scraper{
+		Url:         u,
+		MaxRedirect: opts.MaxRedirect,
+		UserAgent:   opts.UserAgent,
+		Client:      client,
+		Timeout:     opts.Timeout,
+		Headers:     opts.Headers,
+		MaxBodySize: opts.MaxBodySize,
+		MaxPDFSize:  opts.MaxPDFSize,
+
+		OEmbedProviders: opts.OEmbedProviders,
+		DisableOEmbed:   opts.DisableOEmbed,
+		Cache:           opts.Cache,
+		CacheTTL:        opts.CacheTTL,
+	}
+	return scraper.ScrapeContext(ctx)
+}
+
+// clientWithProxy : copy of client sending the requests through proxy
+func clientWithProxy(client *http.Client, proxy *url.URL) (*http.Client, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if proxy == nil {
+		return client, nil
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("cannot set a proxy to the transport of the client: %T", client.Transport)
+	}
+	transport.Proxy = http.ProxyURL(proxy)
+	c := *client
+	c.Transport = transport
+	return &c, nil
 }
 
 func (scraper *Scraper) Scrape() (*Document, error) {
-	doc, err := scraper.getDocument()
-	if err != nil {
-		return nil, err
+	return scraper.ScrapeContext(context.Background())
+}
+
+func (scraper *Scraper) ScrapeContext(ctx context.Context) (*Document, error) {
+	key := NormalizeURL(scraper.Url)
+	var cached *CachedPreview
+	if scraper.Cache != nil {
+		cached, _ = scraper.Cache.Get(key)
+	}
+	if cached != nil && cached.fresh(scraper.CacheTTL) {
+		return cached.document(), nil
+	}
+	if cached != nil && cached.revalidatable() {
+		scraper.conditional = cached
 	}
-	err = scraper.parseDocument(doc)
+	doc, err := scraper.getDocument(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if doc.StatusCode == http.StatusNotModified && cached != nil {
+		if doc.body != nil {
+			doc.body.Close()
+		}
+		cached.StoredAt = time.Now()
+		scraper.Cache.Put(cached)
+		return cached.document(), nil
+	}
+	if doc.body != nil { // HTML
+		err = scraper.parseDocument(ctx, doc)
+		if err != nil {
+			return nil, err
+		}
+		extract(scraper.Url, doc)
+	}
+	if !scraper.DisableOEmbed && doc.StatusCode == http.StatusOK {
+		scraper.oembed(ctx, doc)
+	}
+	if scraper.Cache != nil && doc.StatusCode == http.StatusOK {
+		scraper.Cache.Put(&CachedPreview{
+			Key:           key,
+			ETag:          doc.etag,
+			LastModified:  doc.lastModified,
+			StatusCode:    doc.StatusCode,
+			ContentType:   doc.ContentType,
+			ContentLength: doc.ContentLength,
+			Preview:       doc.Preview,
+			StoredAt:      time.Now(),
+		})
+	}
 	return doc, nil
 }
 
@@ -134,7 +295,7 @@ func (scraper *Scraper) toFragmentUrl() error {
 	return nil
 }
 
-func (scraper *Scraper) getDocument() (*Document, error) {
+func (scraper *Scraper) getDocument(ctx context.Context) (*Document, error) {
 	scraper.MaxRedirect -= 1
 	if strings.Contains(scraper.Url.String(), "#!") {
 		scraper.toFragmentUrl()
@@ -143,17 +304,46 @@ func (scraper *Scraper) getDocument() (*Document, error) {
 		scraper.EscapedFragmentUrl = scraper.Url
 	}
 
-	req, err := http.NewRequest("GET", scraper.getUrl(), nil)
+	timeout := scraper.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 { // until the body is parsed
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", scraper.getUrl(), nil)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
-	req.Header.Add("User-Agent", "GoScraper")
+	for key, values := range scraper.Headers {
+		for _, v := range values {
+			req.Header.Add(key, v)
+		}
+	}
+	userAgent := scraper.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if c := scraper.conditional; c != nil { // only the first request: the refetched urls are other pages
+		scraper.conditional = nil
+		if c.ETag != "" {
+			req.Header.Set("If-None-Match", c.ETag)
+		}
+		if c.LastModified != "" {
+			req.Header.Set("If-Modified-Since", c.LastModified)
+		}
+	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if resp != nil {
-		defer resp.Body.Close()
+	client := scraper.Client
+	if client == nil {
+		client = http.DefaultClient
 	}
+	resp, err := client.Do(req)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
@@ -161,53 +351,250 @@ func (scraper *Scraper) getDocument() (*Document, error) {
 		scraper.EscapedFragmentUrl = nil
 		scraper.Url = resp.Request.URL
 	}
-	b, err := convertUTF8(resp.Body, resp.Header.Get("content-type"))
-	if err != nil {
-		return nil, err
+	doc := &Document{
+		StatusCode:    resp.StatusCode,
+		ContentLength: resp.ContentLength,
+		Preview:       DocumentPreview{Link: scraper.Url.String()},
+		etag:          resp.Header.Get("ETag"),
+		lastModified:  resp.Header.Get("Last-Modified"),
+	}
+	content := bufio.NewReader(resp.Body)
+	doc.ContentType, _, err = mime.ParseMediaType(resp.Header.Get("content-type"))
+	if err != nil { // missing or malformed: sniff the first bytes
+		content.Peek(1) // what has arrived, not to wait for 512 bytes of a slow stream
+		sniff, _ := content.Peek(content.Buffered())
+		doc.ContentType, _, _ = mime.ParseMediaType(http.DetectContentType(sniff))
+	}
+	if doc.ContentType == "application/pdf" {
+		scraper.pdfDocument(doc, content, resp.Header.Get("content-disposition"))
+		resp.Body.Close()
+		cancel()
+		return doc, nil
+	}
+	if !isHTML(doc.ContentType) { // e.g. a 2 GB ISO or a video stream is not downloaded
+		scraper.fileDocument(doc, resp.Header.Get("content-disposition"))
+		resp.Body.Close()
+		cancel()
+		return doc, nil
 	}
-	doc := &Document{Body: b, Preview: DocumentPreview{Link: scraper.Url.String()}}
 
+	maxBodySize := scraper.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	var limited io.Reader = content
+	if maxBodySize > 0 { // the rest is ignored
+		limited = io.LimitReader(content, maxBodySize)
+	}
+	doc.body = &responseBody{Reader: convertUTF8(limited, content, resp.Header.Get("content-type")), body: resp.Body, cancel: cancel}
 	return doc, nil
 }
 
-func convertUTF8(content io.Reader, contentType string) (bytes.Buffer, error) {
-	buff := bytes.Buffer{}
-	content, err := charset.NewReader(content, contentType)
-	if err != nil {
-		return buff, err
+// convertUTF8 : decoder of content to UTF-8, by the charset of contentType or the bytes already buffered
+// (charset.NewReader would wait for 1024 bytes of a slow stream)
+func convertUTF8(content io.Reader, buffered *bufio.Reader, contentType string) io.Reader {
+	buffered.Peek(1)
+	n := buffered.Buffered()
+	if n > 1024 {
+		n = 1024
+	}
+	head, _ := buffered.Peek(n)
+	e, _, _ := charset.DetermineEncoding(head, contentType)
+	return transform.NewReader(content, e.NewDecoder())
+}
+
+// responseBody : UTF-8 body of a response, which releases the request on Close
+type responseBody struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (r *responseBody) Close() error {
+	defer r.cancel()
+	return r.body.Close()
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// fileDocument : preview of a non-HTML response from its name, type & size
+// (images are their own preview image)
+func (scraper *Scraper) fileDocument(doc *Document, contentDisposition string) {
+	name := ""
+	if _, params, err := mime.ParseMediaType(contentDisposition); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(scraper.Url.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = scraper.Url.Host
+	}
+	doc.Preview.Name = scraper.Url.Host
+	doc.Preview.Icon = fmt.Sprintf("%s://%s%s", scraper.Url.Scheme, scraper.Url.Host, "/favicon.ico")
+	doc.Preview.Title = name
+	doc.Preview.Description = describeFile(doc.ContentType, doc.ContentLength)
+	doc.Preview.Images = []string{}
+	if strings.HasPrefix(doc.ContentType, "image/") {
+		doc.Preview.Images = []string{scraper.Url.String()}
+	}
+}
+
+// pdfDocument : preview of a PDF document from its metadata (title, author, subject & page count)
+// the file preview is kept for the documents too large or broken
+func (scraper *Scraper) pdfDocument(doc *Document, content io.Reader, contentDisposition string) {
+	maxPDFSize := scraper.MaxPDFSize
+	if maxPDFSize == 0 {
+		maxPDFSize = DefaultMaxPDFSize
+	}
+	if maxPDFSize < 0 || doc.ContentLength > maxPDFSize {
+		scraper.fileDocument(doc, contentDisposition)
+		return
 	}
-	_, err = io.Copy(&buff, content)
+	data, err := io.ReadAll(io.LimitReader(content, maxPDFSize+1))
+	if err == nil && doc.ContentLength < 0 && int64(len(data)) <= maxPDFSize {
+		doc.ContentLength = int64(len(data))
+	}
+	scraper.fileDocument(doc, contentDisposition)
+	if err != nil || int64(len(data)) > maxPDFSize {
+		return
+	}
+	info, err := pdf.Extract(data)
 	if err != nil {
-		return buff, err
+		return
+	}
+	if strings.TrimSpace(info.Title) != "" {
+		doc.Preview.Title = strings.TrimSpace(info.Title)
 	}
-	return buff, nil
+	if strings.TrimSpace(info.Subject) != "" {
+		doc.Preview.Description = strings.TrimSpace(info.Subject)
+	}
+	doc.Preview.Author = strings.TrimSpace(info.Author)
+	doc.Preview.Pages = info.Pages
 }
 
-func (scraper *Scraper) parseDocument(doc *Document) error {
-	t := html.NewTokenizer(&doc.Body)
-	var ogImage bool
+var fileKinds = map[string]string{
+	"application/pdf": "PDF document",
+	"application/zip": "ZIP archive",
+	"text/plain":      "Text file",
+}
+
+// describeFile : e.g. "PDF document, 1.2 MB"
+func describeFile(mediaType string, size int64) string {
+	kind, ok := fileKinds[mediaType]
+	switch {
+	case ok:
+	case strings.HasPrefix(mediaType, "image/"):
+		kind = "Image (" + strings.TrimPrefix(mediaType, "image/") + ")"
+	case strings.HasPrefix(mediaType, "video/"):
+		kind = "Video (" + strings.TrimPrefix(mediaType, "video/") + ")"
+	case strings.HasPrefix(mediaType, "audio/"):
+		kind = "Audio (" + strings.TrimPrefix(mediaType, "audio/") + ")"
+	default:
+		kind = "File (" + mediaType + ")"
+	}
+	if size < 0 {
+		return kind
+	}
+	return kind + ", " + formatSize(size)
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// parseDocument : read the preview from doc.body until the end of <head> if possible
+// the fields are filled from Open Graph, Twitter cards, JSON-LD, microdata & plain HTML (see precedence);
+// the body is read for the images, microdata & JSON-LD unless <head> has a title & an image,
+// and always for the extractors, which read elements of the body (see Extractor)
+// the URLs are resolved against the base of the document: the first <base href> or the URL of the response
+func (scraper *Scraper) parseDocument(ctx context.Context, doc *Document) error {
+	body := doc.body // doc is overwritten by the refetches
+	defer body.Close()
+	t := html.NewTokenizer(io.TeeReader(body, &doc.Body))
 	var headPassed bool
+	var headChecked bool
 	var hasFragment bool
 	var hasCanonical bool
-	var canonicalUrl *url.URL
-	doc.Preview.Images = []string{}
+	var hasBase bool
+	var canonicalHref string
+	var iconHref string
+	var oembedHref string
+	base := scraper.Url
+	meta := newMetadata()
+	items := &microdata{}
+	candidates := &imageCandidates{}
 	// saves previews' link in case that <link rel="canonical"> is found after <meta property="og:url">
 	link := doc.Preview.Link
 	// set default value to site name if <meta property="og:site_name"> not found
 	doc.Preview.Name = scraper.Url.Host
 	// set default icon to web root if <link rel="icon" href="/favicon.ico"> not found
 	doc.Preview.Icon = fmt.Sprintf("%s://%s%s", scraper.Url.Scheme, scraper.Url.Host, "/favicon.ico")
+	// done : the raw URLs resolved once <base href> is known
+	done := func() {
+		resolve := func(raw string) string { return resolveUrl(base, raw) }
+		candidates.add(meta.values[srcJSONLD][fieldImage], ImageJSONLD, 0, 0)
+		candidates.add(meta.values[srcMicrodata][fieldImage], ImageMicrodata, 0, 0)
+		doc.Preview.ImageCandidates = candidates.rank(resolve)
+		doc.Preview.Images = imageUrls(doc.Preview.ImageCandidates)
+		if icon := resolve(iconHref); icon != "" {
+			doc.Preview.Icon = icon
+		}
+		doc.oembedUrl = resolve(oembedHref)
+		if l := resolve(doc.Preview.Link); l != "" {
+			doc.Preview.Link = l
+		}
+		meta.apply(&doc.Preview)
+	}
 	for {
 		tokenType := t.Next()
 		if tokenType == html.ErrorToken {
+			if err := t.Err(); err != io.EOF { // e.g. timeout
+				return err
+			}
+			done()
 			return nil
 		}
+		if tokenType == html.TextToken {
+			items.text(meta, string(t.Text()))
+			continue
+		}
 		if tokenType != html.SelfClosingTagToken && tokenType != html.StartTagToken && tokenType != html.EndTagToken {
 			continue
 		}
 		token := t.Token()
+		if tokenType == html.EndTagToken {
+			items.end(token.Data)
+		} else {
+			items.start(meta, token, tokenType == html.SelfClosingTagToken)
+		}
 
 		switch token.Data {
+		case "html":
+			for _, attr := range token.Attr {
+				if cleanStr(attr.Key) == "lang" {
+					meta.set(srcHTML, fieldLocale, attr.Val)
+				}
+			}
+		case "base":
+			for _, attr := range token.Attr {
+				if cleanStr(attr.Key) == "href" && !hasBase { // only the first one counts
+					if u, err := url.Parse(strings.TrimSpace(attr.Val)); err == nil {
+						base, hasBase = scraper.Url.ResolveReference(u), true
+					}
+				}
+			}
 		case "head":
 			if tokenType == html.EndTagToken {
 				headPassed = true
@@ -218,8 +605,20 @@ func (scraper *Scraper) parseDocument(doc *Document) error {
 		case "link":
 			var canonical bool
 			var hasIcon bool
+			var touchIcon bool
+			var oembed bool
 			var href string
+			var sizes string
 			for _, attr := range token.Attr {
+				if cleanStr(attr.Key) == "type" && cleanStr(attr.Val) == "application/json+oembed" {
+					oembed = true
+				}
+				if cleanStr(attr.Key) == "rel" && strings.HasPrefix(cleanStr(attr.Val), "apple-touch-icon") {
+					touchIcon = true
+				}
+				if cleanStr(attr.Key) == "sizes" {
+					sizes = attr.Val
+				}
 				if cleanStr(attr.Key) == "rel" && cleanStr(attr.Val) == "canonical" {
 					canonical = true
 				}
@@ -231,125 +630,190 @@ func (scraper *Scraper) parseDocument(doc *Document) error {
 				}
 				if len(href) > 0 && canonical && link != href {
 					hasCanonical = true
-					var err error
-					canonicalUrl, err = url.Parse(href)
-					if err != nil {
-						return err
-					}
+					canonicalHref = href
 				}
 				if len(href) > 0 && hasIcon {
-					doc.Preview.Icon = href
+					iconHref = href
 				}
 			}
+			if touchIcon {
+				w, h := parseSizes(sizes)
+				candidates.add(href, ImageAppleTouchIcon, w, h)
+			}
+			if oembed && oembedHref == "" {
+				oembedHref = href
+			}
 
 		case "meta":
-			if len(token.Attr) != 2 {
-				break
-			}
 			if metaFragment(token) && scraper.EscapedFragmentUrl == nil {
 				hasFragment = true
 			}
 			var property string
+			var name string
 			var content string
 			for _, attr := range token.Attr {
-				if cleanStr(attr.Key) == "property" || cleanStr(attr.Key) == "name" {
-					property = attr.Val
-				}
-				if cleanStr(attr.Key) == "content" {
+				switch cleanStr(attr.Key) {
+				case "property":
+					property = cleanStr(attr.Val)
+				case "name":
+					name = cleanStr(attr.Val)
+				case "content":
 					content = attr.Val
 				}
 			}
-			switch cleanStr(property) {
+			if property == "" { // e.g. <meta name="og:title"> or <meta name="twitter:title">
+				property = name
+			}
+			switch property {
 			case "og:site_name":
-				doc.Preview.Name = content
+				meta.set(srcOpenGraph, fieldSiteName, content)
 			case "og:title":
-				doc.Preview.Title = content
+				meta.set(srcOpenGraph, fieldTitle, content)
 			case "og:description":
-				doc.Preview.Description = content
-			case "description":
-				if len(doc.Preview.Description) == 0 {
-					doc.Preview.Description = content
-				}
+				meta.set(srcOpenGraph, fieldDescription, content)
 			case "og:url":
 				doc.Preview.Link = content
-			case "og:image":
-				ogImage = true
-				ogImgUrl, err := url.Parse(content)
-				if err != nil {
-					return err
+			case "og:image", "og:image:url", "og:image:secure_url":
+				if strings.TrimSpace(content) != "" {
+					candidates.add(content, ImageOpenGraph, 0, 0)
 				}
-				if !ogImgUrl.IsAbs() {
-					ogImgUrl, err = url.Parse(fmt.Sprintf("%s://%s%s", scraper.Url.Scheme, scraper.Url.Host, ogImgUrl.Path))
-					if err != nil {
-						return err
-					}
+			case "og:image:width":
+				candidates.size(ImageOpenGraph, parseLength(content), 0)
+			case "og:image:height":
+				candidates.size(ImageOpenGraph, 0, parseLength(content))
+			case "og:type":
+				meta.set(srcOpenGraph, fieldType, content)
+			case "og:locale":
+				meta.set(srcOpenGraph, fieldLocale, content)
+			case "article:author":
+				if !strings.HasPrefix(cleanStr(content), "http") { // often the URL of a profile
+					meta.set(srcOpenGraph, fieldAuthor, content)
 				}
+			case "article:published_time":
+				meta.set(srcOpenGraph, fieldPublished, content)
+			case "article:tag":
+				meta.add(srcOpenGraph, fieldKeywords, content)
+			case "twitter:title":
+				meta.set(srcTwitter, fieldTitle, content)
+			case "twitter:description":
+				meta.set(srcTwitter, fieldDescription, content)
+			case "twitter:image", "twitter:image:src":
+				if strings.TrimSpace(content) != "" {
+					candidates.add(content, ImageTwitter, 0, 0)
+				}
+			case "twitter:creator":
+				meta.set(srcTwitter, fieldAuthor, content)
+			case "description":
+				meta.set(srcHTML, fieldDescription, content)
+			case "author":
+				meta.set(srcHTML, fieldAuthor, content)
+			case "keywords":
+				meta.add(srcHTML, fieldKeywords, content)
+			case "date", "pubdate":
+				meta.set(srcHTML, fieldPublished, content)
+			}
 
-				doc.Preview.Images = []string{ogImgUrl.String()}
-
+		case "script":
+			if tokenType != html.StartTagToken {
+				break
+			}
+			for _, attr := range token.Attr {
+				if cleanStr(attr.Key) == "type" && cleanStr(attr.Val) == "application/ld+json" {
+					if t.Next() == html.TextToken {
+						meta.parseJSONLD(string(t.Text()))
+					}
+					break
+				}
 			}
 
 		case "title":
 			if tokenType == html.StartTagToken {
-				t.Next()
-				token = t.Token()
-				if len(doc.Preview.Title) == 0 {
-					doc.Preview.Title = token.Data
+				if t.Next() == html.TextToken {
+					meta.set(srcHTML, fieldTitle, string(t.Text()))
 				}
 			}
 
 		case "img":
+			var src, lazySrc string
+			var width, height int
 			for _, attr := range token.Attr {
-				if cleanStr(attr.Key) == "src" {
-					imgUrl, err := url.Parse(attr.Val)
-					if err != nil {
-						return err
-					}
-					if !imgUrl.IsAbs() {
-						doc.Preview.Images = append(doc.Preview.Images, fmt.Sprintf("%s://%s%s", scraper.Url.Scheme, scraper.Url.Host, imgUrl.Path))
-					} else {
-						doc.Preview.Images = append(doc.Preview.Images, attr.Val)
-					}
-
+				switch cleanStr(attr.Key) {
+				case "src":
+					src = attr.Val
+				case "data-src", "data-lazy-src", "data-original": // lazy loading with a placeholder in src
+					lazySrc = attr.Val
+				case "width":
+					width = parseLength(attr.Val)
+				case "height":
+					height = parseLength(attr.Val)
 				}
 			}
+			if lazySrc != "" && (src == "" || strings.HasPrefix(cleanStr(src), "data:")) {
+				src = lazySrc
+			}
+			candidates.add(src, ImageTag, width, height)
 		}
 
 		if hasCanonical && headPassed && scraper.MaxRedirect > 0 {
-			if !canonicalUrl.IsAbs() {
-				absCanonical, err := url.Parse(fmt.Sprintf("%s://%s%s", scraper.Url.Scheme, scraper.Url.Host, canonicalUrl.Path))
-				if err != nil {
-					return err
-				}
-				canonicalUrl = absCanonical
+			hasCanonical = false
+			canonicalUrl, err := url.Parse(resolveUrl(base, canonicalHref))
+			if err != nil || canonicalUrl.String() == "" || canonicalUrl.String() == link || canonicalUrl.String() == scraper.Url.String() {
+				continue // invalid or the scraped page itself
 			}
 			scraper.Url = canonicalUrl
 			scraper.EscapedFragmentUrl = nil
-			fdoc, err := scraper.getDocument()
+			fdoc, err := scraper.getDocument(ctx)
 			if err != nil {
 				return err
 			}
 			*doc = *fdoc
-			return scraper.parseDocument(doc)
+			if doc.body == nil {
+				return nil
+			}
+			return scraper.parseDocument(ctx, doc)
 		}
 
 		if hasFragment && headPassed && scraper.MaxRedirect > 0 {
 			scraper.toFragmentUrl()
-			fdoc, err := scraper.getDocument()
+			fdoc, err := scraper.getDocument(ctx)
 			if err != nil {
 				return err
 			}
 			*doc = *fdoc
-			return scraper.parseDocument(doc)
+			if doc.body == nil {
+				return nil
+			}
+			return scraper.parseDocument(ctx, doc)
 		}
 
-		if len(doc.Preview.Title) > 0 && len(doc.Preview.Description) > 0 && ogImage && headPassed {
-			return nil
+		// the body is only read for the images, structured data & extractors:
+		// decided once at the end of <head>, as the first <img> of the body is rarely the best image
+		if headPassed && !headChecked {
+			headChecked = true
+			image := len(candidates.raw) > 0 || meta.get(fieldImage) != ""
+			if meta.get(fieldTitle) != "" && image && findExtractor(scraper.Url) == nil {
+				done()
+				return nil
+			}
 		}
-
 	}
+}
 
-	return nil
+// resolveUrl : raw relative to base ("" if invalid or not http(s), e.g. data: or javascript:)
+func resolveUrl(base *url.URL, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
 }
 
 func avoidByte(b byte) bool {
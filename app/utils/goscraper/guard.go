@@ -0,0 +1,237 @@
+package goscraper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blockedRanges : addresses which are never fetched unless allowed (private networks, the host itself & cloud metadata)
+var blockedRanges = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), "a reserved address"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "a private address"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "a shared address (carrier-grade NAT)"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "a loopback address"},
+	{netip.MustParsePrefix("169.254.169.254/32"), "the cloud metadata address"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "a link-local address"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "a private address"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "a reserved address"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "a private address"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "a reserved address"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "a multicast address"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "a reserved address"},
+	{netip.MustParsePrefix("::/128"), "a reserved address"},
+	{netip.MustParsePrefix("::1/128"), "a loopback address"},
+	{netip.MustParsePrefix("64:ff9b::/96"), "a NAT64 address"},
+	{netip.MustParsePrefix("2001::/32"), "a Teredo address"}, // tunnels to any IPv4 address
+	{netip.MustParsePrefix("2002::/16"), "a 6to4 address"},
+	{netip.MustParsePrefix("fd00:ec2::254/128"), "the cloud metadata address"},
+	{netip.MustParsePrefix("fc00::/7"), "a private address"},
+	{netip.MustParsePrefix("fe80::/10"), "a link-local address"},
+	{netip.MustParsePrefix("ff00::/8"), "a multicast address"},
+}
+
+// BlockedError : a url which is not fetched by the Guard
+type BlockedError struct {
+	URL    string // or host:port of a connection
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("blocked url %v: %v", e.URL, e.Reason)
+}
+
+// Guard : protection against server-side request forgery
+// the addresses are checked after DNS resolution on every connection (redirects & oEmbed endpoints included),
+// and the connection is made to the checked address
+type Guard struct {
+	hosts    []string       // allowed host names (path.Match syntax, e.g. "*.intranet.example.com")
+	prefixes []netip.Prefix // allowed addresses
+
+	proxies sync.Map // host:port of the proxies, which are dialed without check
+}
+
+// NewGuard : guard allowing the hosts of allow, which are host names, IP addresses or CIDR ranges
+// (e.g. "wiki.internal", "*.corp.example.com", "10.1.2.3" or "192.168.10.0/24")
+func NewGuard(allow []string) (*Guard, error) {
+	g := &Guard{}
+	for _, a := range allow {
+		a = strings.ToLower(strings.TrimSpace(a))
+		switch {
+		case a == "":
+		case strings.Contains(a, "/"):
+			prefix, err := netip.ParsePrefix(a)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR range %q: %w", a, err)
+			}
+			g.prefixes = append(g.prefixes, prefix.Masked())
+		default:
+			if addr, err := netip.ParseAddr(strings.Trim(a, "[]")); err == nil {
+				g.prefixes = append(g.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			if _, err := path.Match(a, ""); err != nil {
+				return nil, fmt.Errorf("invalid host pattern %q: %w", a, err)
+			}
+			g.hosts = append(g.hosts, a)
+		}
+	}
+	return g, nil
+}
+
+// allowedHost : host is allowed by name (any address)
+func (g *Guard) allowedHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, pattern := range g.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddr : the reason why addr is not fetched ("" if it is)
+func (g *Guard) checkAddr(addr netip.Addr) string {
+	addr = addr.Unmap()
+	for _, prefix := range g.prefixes {
+		if prefix.Contains(addr) {
+			return ""
+		}
+	}
+	for _, r := range blockedRanges {
+		if r.prefix.Contains(addr) {
+			return fmt.Sprintf("%v is %v", addr, r.reason)
+		}
+	}
+	return ""
+}
+
+// CheckURL : u is not fetched unless it is http(s) to an allowed host, whose addresses are resolved
+// (the connections are checked again: DNS may answer another address then)
+func (g *Guard) CheckURL(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &BlockedError{URL: u.String(), Reason: "only http & https urls are fetched"}
+	}
+	host := u.Hostname()
+	if host == "" {
+		return &BlockedError{URL: u.String(), Reason: "the url has no host"}
+	}
+	if g.allowedHost(host) {
+		return nil
+	}
+	addrs, err := g.resolve(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if reason := g.checkAddr(addr); reason != "" {
+			return &BlockedError{URL: u.String(), Reason: reason}
+		}
+	}
+	return nil
+}
+
+func (g *Guard) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
+
+// dialContext : dial of the addresses of the host which are not blocked
+func (g *Guard) dialContext(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if _, ok := g.proxies.Load(address); ok {
+			return dial(ctx, network, address)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if g.allowedHost(host) {
+			return dial(ctx, network, address)
+		}
+		addrs, err := g.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, addr := range addrs {
+			if reason := g.checkAddr(addr); reason != "" {
+				lastErr = &BlockedError{URL: address, Reason: reason}
+				continue
+			}
+			conn, err := dial(ctx, network, net.JoinHostPort(addr.Unmap().String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no address of %v", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// guardClient : copy of client whose connections are checked by guard
+// (through a proxy, the target urls are checked before the requests since the proxy resolves them)
+func guardClient(client *http.Client, guard *Guard) (*http.Client, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if guard == nil {
+		return client, nil
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return nil, fmt.Errorf("cannot guard the transport of the client: %T", client.Transport)
+	}
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	transport.DialContext = guard.dialContext(dial)
+	if proxy := transport.Proxy; proxy != nil {
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			p, err := proxy(req)
+			if err != nil || p == nil {
+				return p, err
+			}
+			if err := guard.CheckURL(req.Context(), req.URL); err != nil {
+				return nil, err
+			}
+			port := p.Port()
+			if port == "" {
+				port = map[string]string{"https": "443", "socks5": "1080"}[p.Scheme]
+				if port == "" {
+					port = "80"
+				}
+			}
+			guard.proxies.Store(net.JoinHostPort(p.Hostname(), port), true)
+			return p, nil
+		}
+	}
+	c := *client
+	c.Transport = transport
+	return &c, nil
+}
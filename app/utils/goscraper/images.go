@@ -0,0 +1,177 @@
+package goscraper
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sources of the image candidates
+const (
+	ImageOpenGraph      = "og:image"
+	ImageTwitter        = "twitter:image"
+	ImageJSONLD         = "json-ld"
+	ImageMicrodata      = "microdata"
+	ImageAppleTouchIcon = "apple-touch-icon"
+	ImageTag            = "img"
+)
+
+// ImageCandidate : an image which may illustrate the page
+type ImageCandidate struct {
+	URL    string
+	Source string // ImageOpenGraph, ImageTwitter, ...
+	Width  int    // declared by the page (0 if unknown)
+	Height int
+	Score  int // higher is better
+}
+
+// sourceScores : the images chosen by the site for the previews first
+var sourceScores = map[string]int{
+	ImageOpenGraph:      100,
+	ImageTwitter:        90,
+	ImageJSONLD:         80,
+	ImageMicrodata:      70,
+	ImageTag:            40,
+	ImageAppleTouchIcon: 20, // better than nothing
+}
+
+var (
+	// trackers & spacers which are not declared as 1x1
+	pixelRegexp = regexp.MustCompile(`(?i)(^|[/_.-])(pixel|spacer|blank|1x1|transparent|tracking|beacon)([/_.-]|$)|/(tr|b|p)/?$`)
+	// images which rarely illustrate the content
+	decorRegexp = regexp.MustCompile(`(?i)(logo|icon|avatar|badge|button|banner|emoji|gravatar)`)
+	sizesRegexp = regexp.MustCompile(`^(\d+)[xX](\d+)$`)
+)
+
+// imageCandidates : the raw candidates in document order, resolved & ranked by rank
+type imageCandidates struct {
+	raw []ImageCandidate
+}
+
+func (c *imageCandidates) add(raw, source string, width, height int) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+	c.raw = append(c.raw, ImageCandidate{URL: raw, Source: source, Width: width, Height: height})
+}
+
+// size : the last candidate of source (e.g. og:image:width after og:image)
+func (c *imageCandidates) size(source string, width, height int) {
+	for i := len(c.raw) - 1; i >= 0; i-- {
+		if c.raw[i].Source == source {
+			if width > 0 {
+				c.raw[i].Width = width
+			}
+			if height > 0 {
+				c.raw[i].Height = height
+			}
+			return
+		}
+	}
+}
+
+// rank : resolved, filtered & ordered candidates (the best first)
+func (c *imageCandidates) rank(resolve func(string) string) []ImageCandidate {
+	ranked := []ImageCandidate{}
+	seen := map[string]int{}
+	for _, cand := range c.raw {
+		cand.URL = resolve(cand.URL) // data: URIs are dropped here
+		if cand.URL == "" || dropImage(cand) {
+			continue
+		}
+		cand.Score = scoreImage(cand)
+		if i, ok := seen[cand.URL]; ok { // same image from several sources
+			if cand.Score > ranked[i].Score {
+				ranked[i] = cand
+			}
+			continue
+		}
+		seen[cand.URL] = len(ranked)
+		ranked = append(ranked, cand)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
+
+// dropImage : tracking pixels, spacers & SVG sprites
+func dropImage(cand ImageCandidate) bool {
+	if (cand.Width > 0 && cand.Width <= 2) || (cand.Height > 0 && cand.Height <= 2) {
+		return true
+	}
+	u, err := url.Parse(cand.URL)
+	if err != nil {
+		return true
+	}
+	if strings.HasSuffix(strings.ToLower(u.Path), ".svg") &&
+		(u.Fragment != "" || strings.Contains(strings.ToLower(u.Path), "sprite")) {
+		return true
+	}
+	return cand.Source == ImageTag && pixelRegexp.MatchString(u.Path)
+}
+
+// scoreImage : the source, then the declared size & the name of the file
+func scoreImage(cand ImageCandidate) int {
+	score := sourceScores[cand.Source]
+	w, h := cand.Width, cand.Height
+	switch {
+	case w >= 200 && h >= 200, w >= 400, h >= 400:
+		score += 30
+	case (w > 0 && w < 100) || (h > 0 && h < 100):
+		score -= 30 // thumbnails & icons
+	}
+	if w > 0 && h > 0 && (w > 4*h || h > 4*w) { // banners & separators
+		score -= 20
+	}
+	if cand.Source == ImageTag || cand.Source == ImageMicrodata {
+		if decorRegexp.MatchString(path.Base(cand.URL)) || strings.Contains(strings.ToLower(cand.URL), "/ads/") {
+			score -= 15
+		}
+	}
+	return score
+}
+
+// parseLength : "640" or "640px" of width & height (0 if unknown, e.g. "50%")
+func parseLength(s string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s)), "px"))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// parseSizes : the first "180x180" of the sizes of a <link> (0 if unknown, e.g. "any")
+func parseSizes(s string) (int, int) {
+	for _, size := range strings.Fields(s) {
+		if m := sizesRegexp.FindStringSubmatch(size); m != nil {
+			w, _ := strconv.Atoi(m[1])
+			h, _ := strconv.Atoi(m[2])
+			return w, h
+		}
+	}
+	return 0, 0
+}
+
+// imageUrls : the urls of the candidates in order
+func imageUrls(candidates []ImageCandidate) []string {
+	urls := make([]string, len(candidates))
+	for i, cand := range candidates {
+		urls[i] = cand.URL
+	}
+	return urls
+}
+
+// preferImage : cand first (e.g. the thumbnail of an oEmbed response)
+func (p *DocumentPreview) preferImage(cand ImageCandidate) {
+	cand.Score = sourceScores[ImageOpenGraph] + 50
+	candidates := []ImageCandidate{cand}
+	for _, c := range p.ImageCandidates {
+		if c.URL != cand.URL {
+			candidates = append(candidates, c)
+		}
+	}
+	p.ImageCandidates = candidates
+	p.Images = imageUrls(candidates)
+}
@@ -0,0 +1,229 @@
+package goscraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ImageOEmbed : source of the thumbnail of an oEmbed response
+const ImageOEmbed = "oembed"
+
+// maxOEmbedSize : bytes of an oEmbed response
+const maxOEmbedSize = 1 << 20
+
+// OEmbed : oEmbed response (https://oembed.com), only the JSON format is supported
+type OEmbed struct {
+	Type            string // photo, video, link or rich
+	Title           string
+	AuthorName      string
+	AuthorURL       string
+	ProviderName    string
+	ThumbnailURL    string
+	ThumbnailWidth  int
+	ThumbnailHeight int
+	HTML            string // to be sanitized before being embedded (see SanitizeEmbed)
+	URL             string // of photos
+	Width           int
+	Height          int
+}
+
+// OEmbedProvider : endpoint of the pages whose url matches one of the schemes
+type OEmbedProvider struct {
+	Name     string
+	Schemes  []string // e.g. "https://vimeo.com/*" (* matches anything)
+	Endpoint string   // e.g. "https://vimeo.com/api/oembed.{format}"
+}
+
+// DefaultOEmbedProviders : registry used if Options.OEmbedProviders is nil
+var DefaultOEmbedProviders = []OEmbedProvider{
+	{"YouTube", []string{"https://*.youtube.com/watch*", "https://*.youtube.com/shorts/*", "https://youtu.be/*"}, "https://www.youtube.com/oembed"},
+	{"Vimeo", []string{"https://vimeo.com/*", "https://player.vimeo.com/video/*"}, "https://vimeo.com/api/oembed.json"},
+	{"Twitter", []string{"https://twitter.com/*/status/*", "https://x.com/*/status/*"}, "https://publish.twitter.com/oembed"},
+	{"SoundCloud", []string{"https://soundcloud.com/*"}, "https://soundcloud.com/oembed"},
+	{"Spotify", []string{"https://open.spotify.com/*"}, "https://open.spotify.com/oembed"},
+	{"CodePen", []string{"https://codepen.io/*/pen/*"}, "https://codepen.io/api/oembed"},
+	{"CodeSandbox", []string{"https://codesandbox.io/s/*", "https://codesandbox.io/p/*"}, "https://codesandbox.io/oembed"},
+}
+
+// ParseOEmbedProviders : registry in the format of https://oembed.com/providers.json
+func ParseOEmbedProviders(r io.Reader) ([]OEmbedProvider, error) {
+	var list []struct {
+		ProviderName string `json:"provider_name"`
+		Endpoints    []struct {
+			Schemes []string `json:"schemes"`
+			URL     string   `json:"url"`
+		} `json:"endpoints"`
+	}
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+	providers := []OEmbedProvider{}
+	for _, p := range list {
+		for _, e := range p.Endpoints {
+			if len(e.Schemes) == 0 || e.URL == "" { // discovery only
+				continue
+			}
+			if _, err := url.Parse(e.URL); err != nil {
+				return nil, fmt.Errorf("endpoint of %v: %v", p.ProviderName, err)
+			}
+			providers = append(providers, OEmbedProvider{Name: p.ProviderName, Schemes: e.Schemes, Endpoint: e.URL})
+		}
+	}
+	return providers, nil
+}
+
+// match : the scheme of uri matches
+func (p OEmbedProvider) match(uri string) bool {
+	for _, scheme := range p.Schemes {
+		pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(scheme), `\*`, ".*") + "$"
+		if ok, _ := regexp.MatchString(pattern, uri); ok {
+			return true
+		}
+		// most registries only list one of http & https
+		if ok, _ := regexp.MatchString(pattern, strings.Replace(uri, "https://", "http://", 1)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoint : oEmbed url of uri
+func (p OEmbedProvider) endpoint(uri string) string {
+	endpoint := strings.ReplaceAll(p.Endpoint, "{format}", "json")
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + "url=" + url.QueryEscape(uri) + "&format=json"
+}
+
+// oembedEndpoint : discovered by the page (<link type="application/json+oembed">) or from the registry
+func (scraper *Scraper) oembedEndpoint(doc *Document) string {
+	if doc.oembedUrl != "" {
+		return doc.oembedUrl
+	}
+	providers := scraper.OEmbedProviders
+	if providers == nil {
+		providers = DefaultOEmbedProviders
+	}
+	for _, p := range providers {
+		if p.match(scraper.Url.String()) {
+			return p.endpoint(scraper.Url.String())
+		}
+	}
+	return ""
+}
+
+// oembed : preview completed by the oEmbed response of the page
+// (the preview of the page is kept as it is if the provider fails)
+func (scraper *Scraper) oembed(ctx context.Context, doc *Document) {
+	endpoint := scraper.oembedEndpoint(doc)
+	if endpoint == "" {
+		return
+	}
+	o, err := scraper.fetchOEmbed(ctx, endpoint)
+	if err != nil {
+		return
+	}
+	doc.Preview.OEmbed = o
+	if doc.Preview.Title == "" || doc.Preview.Title == scraper.Url.Host {
+		doc.Preview.Title = o.Title
+	}
+	if doc.Preview.Author == "" {
+		doc.Preview.Author = o.AuthorName
+	}
+	thumbnail := o.ThumbnailURL
+	if o.Type == "photo" && o.URL != "" {
+		thumbnail = o.URL
+	}
+	if u := resolveUrl(scraper.Url, thumbnail); u != "" {
+		doc.Preview.preferImage(ImageCandidate{URL: u, Source: ImageOEmbed, Width: o.ThumbnailWidth, Height: o.ThumbnailHeight})
+	}
+}
+
+func (scraper *Scraper) fetchOEmbed(ctx context.Context, endpoint string) (*OEmbed, error) {
+	timeout := scraper.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := scraper.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	client := scraper.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oembed: %v from %v", resp.Status, endpoint)
+	}
+	// sizes are numbers or strings depending on the provider
+	var raw struct {
+		Type            string      `json:"type"`
+		Title           string      `json:"title"`
+		AuthorName      string      `json:"author_name"`
+		AuthorURL       string      `json:"author_url"`
+		ProviderName    string      `json:"provider_name"`
+		ThumbnailURL    string      `json:"thumbnail_url"`
+		ThumbnailWidth  interface{} `json:"thumbnail_width"`
+		ThumbnailHeight interface{} `json:"thumbnail_height"`
+		HTML            string      `json:"html"`
+		URL             string      `json:"url"`
+		Width           interface{} `json:"width"`
+		Height          interface{} `json:"height"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOEmbedSize)).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw.Type == "" {
+		return nil, fmt.Errorf("oembed: no type in the response of %v", endpoint)
+	}
+	return &OEmbed{
+		Type:            raw.Type,
+		Title:           strings.TrimSpace(raw.Title),
+		AuthorName:      strings.TrimSpace(raw.AuthorName),
+		AuthorURL:       raw.AuthorURL,
+		ProviderName:    raw.ProviderName,
+		ThumbnailURL:    raw.ThumbnailURL,
+		ThumbnailWidth:  oembedSize(raw.ThumbnailWidth),
+		ThumbnailHeight: oembedSize(raw.ThumbnailHeight),
+		HTML:            raw.HTML,
+		URL:             raw.URL,
+		Width:           oembedSize(raw.Width),
+		Height:          oembedSize(raw.Height),
+	}, nil
+}
+
+func oembedSize(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case string:
+		i, _ := strconv.Atoi(strings.TrimSpace(n))
+		return i
+	}
+	return 0
+}
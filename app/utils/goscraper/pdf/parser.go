@@ -0,0 +1,302 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+var errSyntax = errors.New("pdf: syntax error")
+
+// parser : reader of the objects in data from pos
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func mustValue(p *parser) object {
+	obj, _ := p.value(0)
+	return obj
+}
+
+func isSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skipSpace : whitespaces & comments
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// token : a regular token (number or keyword)
+func (p *parser) token() string {
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return string(p.data[start:p.pos])
+}
+
+// value : the next object (a stream if a dictionary is followed by "stream")
+func (p *parser) value(depth int) (object, error) {
+	if depth > maxDepth {
+		return nil, errSyntax
+	}
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, errSyntax
+	}
+	switch c := p.data[p.pos]; {
+	case c == '/':
+		p.pos++
+		return p.name(), nil
+	case c == '(':
+		p.pos++
+		return p.literalString(), nil
+	case c == '<' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '<':
+		p.pos += 2
+		dict, err := p.dictionary(depth)
+		if err != nil {
+			return nil, err
+		}
+		return p.maybeStream(dict), nil
+	case c == '<':
+		p.pos++
+		return p.hexString(), nil
+	case c == '[':
+		p.pos++
+		arr := array{}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return nil, errSyntax
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return arr, nil
+			}
+			v, err := p.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number(), nil
+	case isDelimiter(c): // e.g. ">>" or "]" out of place
+		p.pos++
+		return nil, errSyntax
+	}
+	switch tok := p.token(); tok {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return keyword(tok), nil
+	}
+}
+
+func (p *parser) name() name {
+	start := p.pos
+	for p.pos < len(p.data) && !isSpace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	raw := p.data[start:p.pos]
+	if bytes.IndexByte(raw, '#') < 0 {
+		return name(raw)
+	}
+	b := []byte{}
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if n, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				b = append(b, byte(n))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, raw[i])
+	}
+	return name(b)
+}
+
+func (p *parser) dictionary(depth int) (dictionary, error) {
+	dict := dictionary{}
+	for {
+		p.skipSpace()
+		if p.pos+1 < len(p.data) && p.data[p.pos] == '>' && p.data[p.pos+1] == '>' {
+			p.pos += 2
+			return dict, nil
+		}
+		key, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(name)
+		if !ok {
+			return nil, errSyntax
+		}
+		v, err := p.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		dict[k] = v
+	}
+}
+
+// maybeStream : the stream of dict if "stream" follows
+func (p *parser) maybeStream(dict dictionary) object {
+	save := p.pos
+	p.skipSpace()
+	if !bytes.HasPrefix(p.data[p.pos:], []byte("stream")) {
+		p.pos = save
+		return dict
+	}
+	p.pos += len("stream")
+	if p.pos < len(p.data) && p.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	// trust /Length only if it is direct & followed by "endstream" (indirect lengths are not resolved here)
+	if n, ok := dict["Length"].(int64); ok && n >= 0 && start+int(n) <= len(p.data) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(p.data[end:min(len(p.data), end+32)], "\r\n\t ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			p.pos = end
+			return &stream{dict: dict, data: p.data[start:end]}
+		}
+	}
+	i := bytes.Index(p.data[start:], []byte("endstream"))
+	if i < 0 {
+		p.pos = len(p.data)
+		return &stream{dict: dict, data: p.data[start:]}
+	}
+	p.pos = start + i
+	data := bytes.TrimSuffix(p.data[start:start+i], []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return &stream{dict: dict, data: data}
+}
+
+// number : int64, float64 or reference ("12 0 R")
+func (p *parser) number() object {
+	tok := p.token()
+	n, err := strconv.ParseInt(tok, 10, 64)
+	if err != nil {
+		f, _ := strconv.ParseFloat(tok, 64)
+		return f
+	}
+	// lookahead for a reference
+	save := p.pos
+	p.skipSpace()
+	gen, err := strconv.ParseInt(p.token(), 10, 64)
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.data) && p.data[p.pos] == 'R' &&
+			(p.pos+1 == len(p.data) || isSpace(p.data[p.pos+1]) || isDelimiter(p.data[p.pos+1])) {
+			p.pos++
+			return reference{num: n, gen: gen}
+		}
+	}
+	p.pos = save
+	return n
+}
+
+func (p *parser) literalString() []byte {
+	b := []byte{}
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if p.pos >= len(p.data) {
+				return b
+			}
+			e := p.data[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r': // line continuation
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' { // octal (up to 3 digits)
+					n := int(e - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						n = n*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e // \( \) \\ and unknown escapes
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func (p *parser) hexString() []byte {
+	digits := []byte{}
+	for p.pos < len(p.data) && p.data[p.pos] != '>' {
+		if c := p.data[p.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		p.pos++
+	}
+	p.pos++ // '>'
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			break
+		}
+		b = append(b, byte(n))
+	}
+	return b
+}
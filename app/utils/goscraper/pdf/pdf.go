@@ -0,0 +1,310 @@
+// Package pdf reads the metadata of PDF documents: the document information dictionary,
+// the XMP metadata of the catalog and the page count (without cgo or external tools)
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Info : metadata of a document
+// the fields of the document information dictionary win, XMP fills the blank ones
+type Info struct {
+	Title     string
+	Author    string
+	Subject   string
+	Keywords  string
+	Pages     int
+	Encrypted bool // the strings of the information dictionary cannot be read
+}
+
+var ErrNotPDF = errors.New("pdf: not a PDF document")
+
+const (
+	maxDepth      = 64       // nesting of arrays & dictionaries, chains of references
+	maxStreamSize = 16 << 20 // decoded bytes of a stream (against zip bombs)
+)
+
+// Extract : metadata of the PDF document in data
+func Extract(data []byte) (*Info, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data[:min(len(data), 1024)], "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, ErrNotPDF
+	}
+	d := newDocument(data)
+	trailer := d.trailer()
+	if trailer == nil {
+		return nil, errors.New("pdf: cannot find the trailer")
+	}
+	info := &Info{}
+	_, info.Encrypted = trailer["Encrypt"]
+	if !info.Encrypted {
+		if dict, ok := d.resolve(trailer["Info"]).(dictionary); ok {
+			info.Title = d.text(dict["Title"])
+			info.Author = d.text(dict["Author"])
+			info.Subject = d.text(dict["Subject"])
+			info.Keywords = d.text(dict["Keywords"])
+		}
+	}
+	if root, ok := d.resolve(trailer["Root"]).(dictionary); ok {
+		if pages, ok := d.resolve(root["Pages"]).(dictionary); ok {
+			if n, ok := d.resolve(pages["Count"]).(int64); ok && n > 0 {
+				info.Pages = int(n)
+			}
+		}
+		if s, ok := d.resolve(root["Metadata"]).(*stream); ok {
+			if xmp, err := d.decode(s); err == nil {
+				info.fillXMP(xmp)
+			}
+		}
+	}
+	return info, nil
+}
+
+// ----- objects ----- //
+type (
+	name       string
+	dictionary map[name]object
+	array      []object
+	reference  struct{ num, gen int64 }
+	keyword    string
+	object     interface{} // nil, bool, int64, float64, []byte (string), name, dictionary, array, reference, *stream
+)
+
+type stream struct {
+	dict dictionary
+	data []byte // encoded
+}
+
+// ----- document ----- //
+
+// location : where an indirect object is (pos orders the incremental updates)
+type location struct {
+	pos       int
+	container int64 // object stream (0: in the file at pos)
+	index     int   // in the object stream
+}
+
+type document struct {
+	data    []byte
+	objects map[int64]location
+	cache   map[int64]object
+	streams map[int64][]object // parsed object streams
+}
+
+var (
+	objRegexp     = regexp.MustCompile(`(?:^|[^0-9])(\d{1,10})\s+(\d{1,5})\s+obj\b`)
+	trailerRegexp = regexp.MustCompile(`trailer\s*<<`)
+)
+
+// newDocument : index of the objects by scanning the whole file instead of trusting the xref tables
+// (they are often broken, and the scan covers incremental updates)
+func newDocument(data []byte) *document {
+	d := &document{data: data, objects: map[int64]location{}, cache: map[int64]object{}, streams: map[int64][]object{}}
+	for _, m := range objRegexp.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.ParseInt(string(data[m[2]:m[3]]), 10, 64)
+		d.objects[num] = location{pos: m[1]} // the last definition wins
+	}
+	// objects in object streams (PDF 1.5)
+	containers := []int64{}
+	for num := range d.objects {
+		if s, ok := d.get(num).(*stream); ok && s.dict["Type"] == name("ObjStm") {
+			containers = append(containers, num)
+		}
+	}
+	for _, container := range containers {
+		s := d.get(container).(*stream)
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := d.resolve(s.dict["N"]).(int64)
+		first, _ := d.resolve(s.dict["First"]).(int64)
+		if first < 0 || first > int64(len(data)) {
+			continue
+		}
+		header := &parser{data: data[:first]}
+		pos := d.objects[container].pos
+		for i := 0; i < int(n); i++ {
+			num, ok := mustValue(header).(int64)
+			if _, isOffset := mustValue(header).(int64); !ok || !isOffset {
+				break
+			}
+			if prev, ok := d.objects[num]; !ok || prev.pos < pos {
+				d.objects[num] = location{pos: pos, container: container, index: i}
+			}
+		}
+	}
+	d.cache = map[int64]object{} // the compressed objects may replace the cached ones
+	return d
+}
+
+// get : indirect object num (nil if missing or broken)
+func (d *document) get(num int64) object {
+	if obj, ok := d.cache[num]; ok {
+		return obj
+	}
+	d.cache[num] = nil // against cycles
+	loc, ok := d.objects[num]
+	if !ok {
+		return nil
+	}
+	var obj object
+	if loc.container == 0 {
+		p := &parser{data: d.data, pos: loc.pos}
+		obj, _ = p.value(0)
+	} else {
+		obj = d.compressed(loc)
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+func (d *document) compressed(loc location) object {
+	objs, ok := d.streams[loc.container]
+	if !ok {
+		if s, isStream := d.get(loc.container).(*stream); isStream {
+			if data, err := d.decode(s); err == nil {
+				first, _ := d.resolve(s.dict["First"]).(int64)
+				n, _ := d.resolve(s.dict["N"]).(int64)
+				objs = parseObjectStream(data, int(first), int(n))
+			}
+		}
+		d.streams[loc.container] = objs
+	}
+	if loc.index < len(objs) {
+		return objs[loc.index]
+	}
+	return nil
+}
+
+func parseObjectStream(data []byte, first, n int) []object {
+	if first < 0 || first > len(data) {
+		return nil
+	}
+	header := &parser{data: data[:first]}
+	objs := []object{}
+	for i := 0; i < n; i++ {
+		_, err1 := header.value(0)
+		offset, err2 := header.value(0)
+		off, ok := offset.(int64)
+		if err1 != nil || err2 != nil || !ok || first+int(off) > len(data) {
+			break
+		}
+		p := &parser{data: data, pos: first + int(off)}
+		obj, _ := p.value(0)
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// resolve : obj with the references followed
+func (d *document) resolve(obj object) object {
+	for i := 0; i < maxDepth; i++ {
+		r, ok := obj.(reference)
+		if !ok {
+			return obj
+		}
+		obj = d.get(r.num)
+	}
+	return nil
+}
+
+// trailer : the last trailer dictionary (or cross-reference stream) with the catalog
+func (d *document) trailer() dictionary {
+	var found dictionary
+	pos := -1
+	for _, m := range trailerRegexp.FindAllIndex(d.data, -1) {
+		p := &parser{data: d.data, pos: m[0] + len("trailer")}
+		if dict, ok := mustValue(p).(dictionary); ok && dict["Root"] != nil && m[0] > pos {
+			found, pos = dict, m[0]
+		}
+	}
+	for num, loc := range d.objects {
+		if loc.container != 0 || loc.pos < pos {
+			continue
+		}
+		if s, ok := d.get(num).(*stream); ok && s.dict["Type"] == name("XRef") && s.dict["Root"] != nil {
+			found, pos = s.dict, loc.pos
+		}
+	}
+	return found
+}
+
+// decode : data of s (FlateDecode only, or no filter)
+func (d *document) decode(s *stream) ([]byte, error) {
+	filters := []object{}
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case nil:
+	case name:
+		filters = append(filters, f)
+	case array:
+		filters = f
+	}
+	data := s.data
+	for _, f := range filters {
+		if d.resolve(f) != name("FlateDecode") {
+			return nil, errors.New("pdf: unsupported filter")
+		}
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		// broken streams are common: keep what could be inflated
+		data, _ = io.ReadAll(io.LimitReader(r, maxStreamSize))
+		if len(data) == 0 {
+			return nil, errors.New("pdf: cannot inflate a stream")
+		}
+	}
+	return data, nil
+}
+
+// text : text string (UTF-16BE or UTF-8 with a BOM, PDFDocEncoding otherwise)
+func (d *document) text(obj object) string {
+	b, ok := d.resolve(obj).([]byte)
+	if !ok {
+		return ""
+	}
+	return decodeText(b)
+}
+
+func decodeText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return string(b[3:])
+	}
+	runes := make([]rune, 0, len(b))
+	for _, c := range b {
+		if r, ok := pdfDocEncoding[c]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, rune(c)) // same as Latin-1
+		}
+	}
+	return string(runes)
+}
+
+// pdfDocEncoding : the characters different from Latin-1
+var pdfDocEncoding = map[byte]rune{
+	0x80: '•', 0x81: '†', 0x82: '‡', 0x83: '…', 0x84: '—', 0x85: '–', 0x86: 'ƒ', 0x87: '⁄',
+	0x88: '‹', 0x89: '›', 0x8a: '−', 0x8b: '‰', 0x8c: '„', 0x8d: '“', 0x8e: '”', 0x8f: '‘',
+	0x90: '’', 0x91: '‚', 0x92: '™', 0x93: 'ﬁ', 0x94: 'ﬂ', 0x95: 'Ł', 0x96: 'Œ', 0x97: 'Š',
+	0x98: 'Ÿ', 0x99: 'Ž', 0x9a: 'ı', 0x9b: 'ł', 0x9c: 'œ', 0x9d: 'š', 0x9e: 'ž', 0xa0: '€',
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+const (
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+	nsPDF = "http://ns.adobe.com/pdf/1.3/"
+)
+
+// fillXMP : the blank fields of info from the XMP packet
+// (dc:title, dc:creator, dc:description & pdf:Keywords as elements or attributes)
+func (info *Info) fillXMP(packet []byte) {
+	values := map[string][]string{}
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+	field := ""
+	depth, fieldDepth := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			for _, attr := range t.Attr {
+				if key := xmpField(attr.Name); key != "" && strings.TrimSpace(attr.Value) != "" {
+					values[key] = append(values[key], strings.TrimSpace(attr.Value))
+				}
+			}
+			if key := xmpField(t.Name); key != "" && field == "" {
+				field, fieldDepth = key, depth
+			}
+		case xml.EndElement:
+			if depth == fieldDepth {
+				field = ""
+			}
+			depth--
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); field != "" && text != "" {
+				values[field] = append(values[field], text)
+			}
+		}
+	}
+	fill := func(s *string, key string, all bool) {
+		if *s != "" || len(values[key]) == 0 {
+			return
+		}
+		if all {
+			*s = strings.Join(values[key], ", ")
+		} else {
+			*s = values[key][0] // e.g. x-default of rdf:Alt
+		}
+	}
+	fill(&info.Title, "title", false)
+	fill(&info.Author, "creator", true)
+	fill(&info.Subject, "description", false)
+	fill(&info.Keywords, "keywords", false)
+}
+
+func xmpField(n xml.Name) string {
+	switch {
+	case n.Space == nsDC && (n.Local == "title" || n.Local == "creator" || n.Local == "description"):
+		return n.Local
+	case n.Space == nsPDF && n.Local == "Keywords":
+		return "keywords"
+	}
+	return ""
+}
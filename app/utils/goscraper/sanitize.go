@@ -0,0 +1,189 @@
+package goscraper
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// embedTags : elements kept by SanitizeEmbed & their attributes
+var embedTags = map[string][]string{
+	"iframe":     {"src", "width", "height", "title", "allow", "allowfullscreen", "frameborder", "loading"},
+	"img":        {"src", "alt", "width", "height"},
+	"video":      {"src", "poster", "width", "height", "controls"},
+	"audio":      {"src", "controls"},
+	"source":     {"src", "type"},
+	"a":          {"href", "title"},
+	"blockquote": {"cite"},
+	"figure":     {},
+	"figcaption": {},
+	"div":        {},
+	"span":       {},
+	"p":          {},
+	"br":         {},
+	"strong":     {},
+	"em":         {},
+	"b":          {},
+	"i":          {},
+}
+
+// droppedTags : elements removed with their content
+var droppedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "object": true, "embed": true,
+	"form": true, "textarea": true, "select": true, "svg": true, "math": true, "head": true, "title": true,
+}
+
+var voidTags = map[string]bool{"img": true, "source": true, "br": true}
+
+// embedFeatures : permissions an iframe may request with its allow attribute
+var embedFeatures = map[string]bool{
+	"autoplay": true, "encrypted-media": true, "picture-in-picture": true, "fullscreen": true,
+	"clipboard-write": true, "accelerometer": true, "gyroscope": true, "web-share": true,
+}
+
+// SanitizeEmbed : the HTML of an oEmbed response without scripts, event handlers, styles & unsafe urls
+// (iframes are sandboxed, links open in a new tab & the elements are balanced)
+// selfHost is the host of the page showing the HTML: iframes of its pages are dropped
+func SanitizeEmbed(s, selfHost string) string {
+	b := &strings.Builder{}
+	t := html.NewTokenizer(strings.NewReader(s))
+	open := []string{}
+	dropping := ""
+	for {
+		tokenType := t.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		token := t.Token()
+		if dropping != "" {
+			if tokenType == html.EndTagToken && token.Data == dropping {
+				dropping = ""
+			}
+			continue
+		}
+		switch tokenType {
+		case html.TextToken:
+			b.WriteString(html.EscapeString(token.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedTags[token.Data] {
+				if tokenType == html.StartTagToken {
+					dropping = token.Data
+				}
+				continue
+			}
+			allowed, ok := embedTags[token.Data]
+			if !ok {
+				continue // the text is kept
+			}
+			attrs := sanitizeAttrs(token, allowed)
+			if token.Data == "iframe" && sameHost(attrs["src"], selfHost) {
+				delete(attrs, "src")
+			}
+			if (token.Data == "iframe" || token.Data == "img" || token.Data == "source") && attrs["src"] == "" {
+				if token.Data == "iframe" && tokenType == html.StartTagToken {
+					dropping = "iframe"
+				}
+				continue
+			}
+			writeStartTag(b, token.Data, attrs, allowed)
+			if !voidTags[token.Data] && tokenType == html.StartTagToken {
+				open = append(open, token.Data)
+			} else if !voidTags[token.Data] {
+				b.WriteString("</" + token.Data + ">")
+			}
+		case html.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == token.Data {
+					for j := len(open) - 1; j >= i; j-- {
+						b.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		b.WriteString("</" + open[i] + ">")
+	}
+	return b.String()
+}
+
+func sanitizeAttrs(token html.Token, allowed []string) map[string]string {
+	attrs := map[string]string{}
+	for _, attr := range token.Attr {
+		key := cleanStr(attr.Key)
+		if !contains(allowed, key) {
+			continue
+		}
+		val := strings.TrimSpace(attr.Val)
+		switch key {
+		case "src", "href", "poster", "cite":
+			val = safeUrl(val)
+		case "allow":
+			features := []string{}
+			for _, f := range strings.Split(val, ";") {
+				if f = strings.TrimSpace(f); embedFeatures[strings.Fields(f + " ")[0]] {
+					features = append(features, f)
+				}
+			}
+			val = strings.Join(features, "; ")
+		case "width", "height":
+			val = strings.TrimSuffix(val, "px")
+			if parseLength(val) == 0 && val != "100%" {
+				val = ""
+			}
+		}
+		if val != "" || key == "allowfullscreen" || key == "controls" {
+			attrs[key] = val
+		}
+	}
+	return attrs
+}
+
+func writeStartTag(b *strings.Builder, tag string, attrs map[string]string, allowed []string) {
+	b.WriteString("<" + tag)
+	for _, key := range allowed { // stable order
+		if val, ok := attrs[key]; ok {
+			b.WriteString(" " + key + `="` + html.EscapeString(val) + `"`)
+		}
+	}
+	switch tag {
+	case "iframe":
+		b.WriteString(` sandbox="allow-scripts allow-popups allow-presentation" referrerpolicy="strict-origin-when-cross-origin"`)
+	case "a":
+		b.WriteString(` target="_blank" rel="noopener noreferrer nofollow"`)
+	}
+	b.WriteString(">")
+}
+
+// sameHost : rawURL is on host (with or without port), where an iframe could act as the user
+func sameHost(rawURL, host string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), (&url.URL{Host: host}).Hostname())
+}
+
+// safeUrl : absolute http(s) url ("" otherwise, e.g. javascript: or data:)
+func safeUrl(raw string) string {
+	if strings.HasPrefix(raw, "//") { // protocol-relative
+		raw = "https:" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
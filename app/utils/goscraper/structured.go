@@ -0,0 +1,371 @@
+package goscraper
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// sources of the metadata of a page
+const (
+	srcOpenGraph = iota // <meta property="og:*"> & <meta property="article:*">
+	srcTwitter          // <meta name="twitter:*">
+	srcJSONLD           // <script type="application/ld+json"> (schema.org)
+	srcMicrodata        // itemprop attributes (schema.org)
+	srcHTML             // <title>, <meta name="description|author|keywords">, <html lang>
+	numSources
+)
+
+type field int
+
+const (
+	fieldTitle field = iota
+	fieldDescription
+	fieldImage
+	fieldSiteName
+	fieldAuthor
+	fieldPublished
+	fieldKeywords
+	fieldType
+	fieldLocale
+)
+
+// precedence : sources of each field, the first one found wins
+// Open Graph, Twitter cards, JSON-LD, microdata & plain HTML by default, except for:
+//   - author: the names of JSON-LD & microdata before article:author (often a profile URL) & twitter:creator (a @handle)
+//   - published time: JSON-LD & microdata are as good as article:published_time
+//   - keywords: <meta name="keywords"> is the most common
+var precedence = map[field][]int{
+	fieldAuthor:    {srcJSONLD, srcMicrodata, srcHTML, srcOpenGraph, srcTwitter},
+	fieldPublished: {srcOpenGraph, srcJSONLD, srcMicrodata, srcHTML},
+	fieldKeywords:  {srcHTML, srcJSONLD, srcOpenGraph, srcMicrodata},
+}
+
+var defaultPrecedence = []int{srcOpenGraph, srcTwitter, srcJSONLD, srcMicrodata, srcHTML}
+
+// metadata : values of the fields by source, collected while parsing a page
+type metadata struct {
+	values [numSources]map[field]string
+}
+
+func newMetadata() *metadata {
+	m := &metadata{}
+	for i := range m.values {
+		m.values[i] = map[field]string{}
+	}
+	return m
+}
+
+// set : the first value of f from src is kept
+func (m *metadata) set(src int, f field, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if _, ok := m.values[src][f]; !ok {
+		m.values[src][f] = value
+	}
+}
+
+// add : values from several tags (e.g. article:tag or the authors of microdata)
+func (m *metadata) add(src int, f field, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	if prev, ok := m.values[src][f]; ok {
+		value = prev + ", " + value
+	}
+	m.values[src][f] = value
+}
+
+func (m *metadata) get(f field) string {
+	sources, ok := precedence[f]
+	if !ok {
+		sources = defaultPrecedence
+	}
+	for _, src := range sources {
+		if v, ok := m.values[src][f]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// apply : fill the preview (the site name & title are kept if no source has them)
+// the images are ranked apart (see imageCandidates)
+func (m *metadata) apply(p *DocumentPreview) {
+	if v := m.get(fieldTitle); v != "" {
+		p.Title = v
+	}
+	if v := m.get(fieldDescription); v != "" {
+		p.Description = v
+	}
+	if v := m.get(fieldSiteName); v != "" {
+		p.Name = v
+	}
+	p.Author = m.get(fieldAuthor)
+	p.PublishedTime = m.get(fieldPublished)
+	p.Keywords = splitKeywords(m.get(fieldKeywords))
+	p.Type = m.get(fieldType)
+	p.Locale = m.get(fieldLocale)
+}
+
+func splitKeywords(s string) []string {
+	keywords := []string{}
+	seen := map[string]bool{}
+	for _, k := range strings.Split(s, ",") {
+		k = strings.TrimSpace(k)
+		if k != "" && !seen[strings.ToLower(k)] {
+			seen[strings.ToLower(k)] = true
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// ----- JSON-LD ----- //
+
+// secondaryTypes : schema.org nodes which describe the site rather than the page
+var secondaryTypes = map[string]bool{
+	"BreadcrumbList": true, "Organization": true, "WebSite": true, "Person": true,
+	"ImageObject": true, "SiteNavigationElement": true, "SearchAction": true, "ListItem": true,
+}
+
+// parseJSONLD : metadata of the main node of a JSON-LD block (invalid blocks are ignored)
+func (m *metadata) parseJSONLD(data string) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return
+	}
+	nodes := flattenJSONLD(v, 0)
+	var main map[string]interface{}
+	for _, n := range nodes {
+		if main == nil && !secondaryTypes[jsonLDString(n["@type"])] {
+			main = n
+		}
+		if t := jsonLDString(n["@type"]); t == "WebSite" {
+			m.set(srcJSONLD, fieldSiteName, jsonLDString(n["name"]))
+		}
+	}
+	if main == nil {
+		return
+	}
+	title := jsonLDString(main["headline"])
+	if title == "" {
+		title = jsonLDString(main["name"])
+	}
+	m.set(srcJSONLD, fieldTitle, title)
+	m.set(srcJSONLD, fieldDescription, jsonLDString(main["description"]))
+	m.set(srcJSONLD, fieldImage, jsonLDString(main["image"]))
+	m.set(srcJSONLD, fieldAuthor, jsonLDNames(main["author"]))
+	m.set(srcJSONLD, fieldPublished, jsonLDString(main["datePublished"]))
+	m.set(srcJSONLD, fieldKeywords, jsonLDNames(main["keywords"]))
+	m.set(srcJSONLD, fieldType, jsonLDString(main["@type"]))
+	m.set(srcJSONLD, fieldLocale, jsonLDString(main["inLanguage"]))
+	if publisher, ok := main["publisher"].(map[string]interface{}); ok {
+		m.set(srcJSONLD, fieldSiteName, jsonLDString(publisher["name"]))
+	}
+}
+
+// flattenJSONLD : the nodes of arrays & @graph
+func flattenJSONLD(v interface{}, depth int) []map[string]interface{} {
+	if depth > 8 {
+		return nil
+	}
+	nodes := []map[string]interface{}{}
+	switch t := v.(type) {
+	case []interface{}:
+		for _, e := range t {
+			nodes = append(nodes, flattenJSONLD(e, depth+1)...)
+		}
+	case map[string]interface{}:
+		if graph, ok := t["@graph"]; ok {
+			nodes = append(nodes, flattenJSONLD(graph, depth+1)...)
+		}
+		if _, ok := t["@type"]; ok {
+			nodes = append(nodes, t)
+		}
+	}
+	return nodes
+}
+
+// jsonLDString : text of a value ("x", ["x", ...], {"url"|"name"|"@value": "x"})
+func jsonLDString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return strings.TrimSpace(t)
+	case []interface{}:
+		for _, e := range t {
+			if s := jsonLDString(e); s != "" {
+				return s
+			}
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"url", "name", "@value"} {
+			if s := jsonLDString(t[key]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// jsonLDNames : all the names of a value, comma separated (e.g. authors)
+func jsonLDNames(v interface{}) string {
+	if list, ok := v.([]interface{}); ok {
+		names := []string{}
+		for _, e := range list {
+			if s := jsonLDNames(e); s != "" {
+				names = append(names, s)
+			}
+		}
+		return strings.Join(names, ", ")
+	}
+	if node, ok := v.(map[string]interface{}); ok {
+		return jsonLDString(node["name"])
+	}
+	return jsonLDString(v)
+}
+
+// ----- microdata ----- //
+
+// itemScope : element with an itemscope attribute
+type itemScope struct {
+	tag   string
+	depth int    // of the nested elements with the same tag
+	prop  string // itemprop of the element ("" for a top-level item)
+	main  bool   // the item describing the page
+}
+
+// microdata : state of the itemscope & itemprop attributes while tokenizing
+type microdata struct {
+	scopes     []itemScope
+	hasMain    bool
+	pending    field // property waiting for the text of pendingTag
+	pendingTag string
+}
+
+// start : properties & scopes of a start tag
+func (items *microdata) start(meta *metadata, token html.Token, selfClosing bool) {
+	var itemprop, itemtype, value string
+	var itemscope bool
+	for _, attr := range token.Attr {
+		switch cleanStr(attr.Key) {
+		case "itemprop":
+			itemprop = attr.Val
+		case "itemscope":
+			itemscope = true
+		case "itemtype":
+			itemtype = attr.Val
+		case "content", "datetime":
+			value = attr.Val
+		case "href", "src":
+			if value == "" {
+				value = attr.Val
+			}
+		}
+	}
+	if n := len(items.scopes); n > 0 && items.scopes[n-1].tag == token.Data && !selfClosing && !itemscope {
+		items.scopes[n-1].depth++
+	}
+	if itemprop != "" && len(items.scopes) > 0 && !itemscope {
+		cur := items.scopes[len(items.scopes)-1]
+		for _, prop := range strings.Fields(itemprop) {
+			f, add, ok := microdataField(cur, prop)
+			if !ok {
+				continue
+			}
+			switch {
+			case value != "" && add:
+				meta.add(srcMicrodata, f, value)
+			case value != "":
+				meta.set(srcMicrodata, f, value)
+			case !selfClosing:
+				items.pending, items.pendingTag = f, token.Data
+			}
+		}
+	}
+	if itemscope && !selfClosing {
+		scope := itemScope{tag: token.Data, depth: 1}
+		if props := strings.Fields(itemprop); len(props) > 0 {
+			scope.prop = props[0]
+		}
+		if itemprop == "" && !items.hasMain && !secondaryTypes[schemaType(itemtype)] {
+			scope.main, items.hasMain = true, true
+			meta.set(srcMicrodata, fieldType, schemaType(itemtype))
+		}
+		items.scopes = append(items.scopes, scope)
+	}
+}
+
+// end : close the scope of tag
+func (items *microdata) end(tag string) {
+	if tag == items.pendingTag {
+		items.pendingTag = ""
+	}
+	if n := len(items.scopes); n > 0 && items.scopes[n-1].tag == tag {
+		if items.scopes[n-1].depth--; items.scopes[n-1].depth == 0 {
+			items.scopes = items.scopes[:n-1]
+		}
+	}
+}
+
+// text : value of the pending property
+func (items *microdata) text(meta *metadata, text string) {
+	if items.pendingTag == "" || strings.TrimSpace(text) == "" {
+		return
+	}
+	if items.pending == fieldAuthor {
+		meta.add(srcMicrodata, fieldAuthor, text)
+	} else {
+		meta.set(srcMicrodata, items.pending, text)
+	}
+	items.pendingTag = ""
+}
+
+// microdataField : field of the property prop of an item (add if the values are joined)
+func microdataField(scope itemScope, prop string) (field, bool, bool) {
+	switch {
+	case scope.main:
+		switch prop {
+		case "headline", "name":
+			return fieldTitle, false, true
+		case "description":
+			return fieldDescription, false, true
+		case "image", "thumbnailUrl":
+			return fieldImage, false, true
+		case "author", "creator":
+			return fieldAuthor, true, true
+		case "datePublished":
+			return fieldPublished, false, true
+		case "keywords":
+			return fieldKeywords, true, true
+		case "inLanguage":
+			return fieldLocale, false, true
+		}
+	case scope.prop == "author" || scope.prop == "creator":
+		if prop == "name" {
+			return fieldAuthor, true, true
+		}
+	case scope.prop == "publisher":
+		if prop == "name" {
+			return fieldSiteName, false, true
+		}
+	}
+	return 0, false, false
+}
+
+// schemaType : "Article" of "https://schema.org/Article"
+func schemaType(itemtype string) string {
+	types := strings.Fields(itemtype)
+	if len(types) == 0 {
+		return ""
+	}
+	itemtype = strings.TrimRight(types[0], "/")
+	if i := strings.LastIndexAny(itemtype, "/#"); i >= 0 {
+		return itemtype[i+1:]
+	}
+	return itemtype
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// log levels of [log] level
+const (
+	LevelDebug = "debug" // + request traces
+	LevelInfo  = "info"
+)
+
+var debugEnabled int32 // atomic: 1 if [log] level = debug
+
+// SetLogLevel : "debug" or "info" (can be changed at runtime)
+func SetLogLevel(level string) {
+	var v int32
+	if level == LevelDebug {
+		v = 1
+	}
+	atomic.StoreInt32(&debugEnabled, v)
+}
+
+// Debugln : log.Println only if [log] level = debug
+func Debugln(v ...interface{}) {
+	if atomic.LoadInt32(&debugEnabled) == 1 {
+		log.Output(2, fmt.Sprintln(v...))
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Store : the effective settings shared by goroutines
+// fields tagged with `reload:"true"` are replaced atomically on reload, the others need a restart
+type Store struct {
+	v         atomic.Value // Configs
+	path      string
+	overrides []string
+	mu        sync.Mutex // serializes reloads
+}
+
+// NewStore : store of the settings loaded by Setup
+func NewStore(conf Configs) *Store {
+	s := &Store{path: loadedPath, overrides: setFlags}
+	s.v.Store(conf)
+	return s
+}
+
+// Get : current settings (don't keep them for long: they may be reloaded)
+func (s *Store) Get() Configs {
+	return s.v.Load().(Configs)
+}
+
+// Path : config file of the settings
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Reload : load the config file again and apply the hot-reloadable settings
+// changes of the other settings are logged and ignored
+func (s *Store) Reload() (Configs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.Get()
+	loaded, err := Load(s.path, s.overrides)
+	if err == nil {
+		err = loaded.Validate()
+	}
+	if err != nil {
+		return old, err
+	}
+	conf := old
+	ov, lv, cv := reflect.ValueOf(old), reflect.ValueOf(loaded), reflect.ValueOf(&conf).Elem()
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(ov.Field(i).Interface(), lv.Field(i).Interface()) {
+			continue
+		}
+		name := t.Field(i).Tag.Get("conf")
+		if t.Field(i).Tag.Get("reload") != "true" {
+			log.Printf("config reload: %v cannot be changed at runtime (restart to apply it)\n", name)
+			continue
+		}
+		cv.Field(i).Set(lv.Field(i))
+		log.Printf("config reload: %v = %v\n", name, Redact(name, lv.Field(i).Interface()))
+	}
+	s.v.Store(conf)
+	return conf, nil
+}
+
+// Watch : reload on SIGHUP & on changes of the config file until ctx is done
+// onReload is called with the new settings after every successful reload
+func (s *Store) Watch(ctx context.Context, onReload func(Configs)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Println("cannot watch the config file (SIGHUP only): ", err)
+	} else {
+		defer watcher.Close()
+		// watch the directory: editors & ConfigMaps replace the file instead of writing it
+		if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+			log.Println("cannot watch the config file (SIGHUP only): ", err)
+		} else {
+			events = watcher.Events
+		}
+	}
+	target, _ := filepath.Abs(s.path)
+	var debounce <-chan time.Time // a save may produce several events
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Println("SIGHUP received: reloading config")
+			s.reload(onReload)
+		case ev := <-events:
+			if abs, _ := filepath.Abs(ev.Name); abs == target && ev.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				debounce = time.After(200 * time.Millisecond)
+			}
+		case <-debounce:
+			debounce = nil
+			log.Println("config file changed: reloading config")
+			s.reload(onReload)
+		}
+	}
+}
+
+func (s *Store) reload(onReload func(Configs)) {
+	conf, err := s.Reload()
+	if err != nil {
+		log.Printf("config reload failed (keeping the current settings):\n\t%v", err)
+		return
+	}
+	if onReload != nil {
+		onReload(conf)
+	}
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"log"
+	"myTips/tipstocks/app/utils/goscraper"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// ScraperOptions : goscraper.Options of the [scraper] section
+func (conf Configs) ScraperOptions() goscraper.Options {
+	opts := goscraper.Options{
+		Timeout:     conf.ScraperTimeout,
+		UserAgent:   conf.ScraperUserAgent,
+		MaxRedirect: 5,
+		MaxBodySize: int64(conf.ScraperMaxBodySize),
+		MaxPDFSize:  int64(conf.ScraperMaxPDFSize),
+	}
+	if conf.ScraperMaxPDFSize == 0 {
+		opts.MaxPDFSize = -1 // goscraper uses the default for 0
+	}
+	if conf.ScraperProxy != "" {
+		opts.Proxy, _ = url.Parse(conf.ScraperProxy) // checked by Validate
+	}
+	opts.DisableOEmbed = !conf.ScraperOEmbed
+	if conf.ScraperOEmbedProviders != "" {
+		opts.OEmbedProviders, _ = loadOEmbedProviders(conf.ScraperOEmbedProviders) // checked by Validate
+	}
+	opts.Guard, _ = goscraper.NewGuard(conf.ScraperAllowedHosts) // checked by Validate
+	if cache := conf.ScrapeCache(); cache != nil {
+		opts.Cache = cache
+		opts.CacheTTL = conf.ScraperCacheTTL
+	}
+	return opts
+}
+
+// scrapeCache : the cache of the previews, opened again when [scraper] cache_dir is changed
+var scrapeCache struct {
+	sync.Mutex
+	cache *goscraper.DiskCache
+}
+
+// ScrapeCache : the cache of [scraper] cache_dir (nil with cache_max_entries = 0 or if the directory cannot be used)
+func (conf Configs) ScrapeCache() *goscraper.DiskCache {
+	scrapeCache.Lock()
+	defer scrapeCache.Unlock()
+	if conf.ScraperCacheMaxEntries <= 0 {
+		return nil // the files are kept for the next time it is turned on
+	}
+	if scrapeCache.cache == nil || scrapeCache.cache.Dir() != conf.ScraperCacheDir {
+		cache, err := goscraper.NewDiskCache(conf.ScraperCacheDir, conf.ScraperCacheMaxEntries)
+		if err != nil {
+			log.Println("Cannot use the scrape cache: ", err)
+			return nil
+		}
+		flushScrapeCache()
+		scrapeCache.cache = cache
+	}
+	scrapeCache.cache.SetMaxEntries(conf.ScraperCacheMaxEntries)
+	return scrapeCache.cache
+}
+
+// FlushScrapeCache : the order of use of the cached previews is saved for the next start (on shutdown)
+func FlushScrapeCache() {
+	scrapeCache.Lock()
+	defer scrapeCache.Unlock()
+	flushScrapeCache()
+}
+
+func flushScrapeCache() {
+	if scrapeCache.cache == nil {
+		return
+	}
+	if err := scrapeCache.cache.Flush(); err != nil {
+		log.Println("Cannot save the order of the scrape cache: ", err)
+	}
+}
+
+// oembedProviders : the registry read from a file, until the file is modified
+var oembedProviders struct {
+	sync.Mutex
+	path      string
+	modTime   time.Time
+	providers []goscraper.OEmbedProvider
+}
+
+func loadOEmbedProviders(path string) ([]goscraper.OEmbedProvider, error) {
+	oembedProviders.Lock()
+	defer oembedProviders.Unlock()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if path == oembedProviders.path && info.ModTime().Equal(oembedProviders.modTime) {
+		return oembedProviders.providers, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	providers, err := goscraper.ParseOEmbedProviders(f)
+	if err != nil {
+		return nil, err
+	}
+	oembedProviders.path, oembedProviders.modTime, oembedProviders.providers = path, info.ModTime(), providers
+	return providers, nil
+}
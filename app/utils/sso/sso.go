@@ -0,0 +1,178 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Config : [oidc] section of config.ini
+type Config struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string   // e.g. http://localhost:8081/login/oidc/callback
+	AllowedDomains []string // domains of the email addresses allowed to sign in (any if empty)
+}
+
+// Provider : OpenID Connect authorization code flow with PKCE
+type Provider struct {
+	conf     Config
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// Flow : state of an authorization request kept by the browser until the callback
+type Flow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+}
+
+// Identity : claims of the ID token
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// ErrDomainNotAllowed : the email address is not in [oidc] allowed_domains
+var ErrDomainNotAllowed = errors.New("the email domain is not allowed to sign in")
+
+// New : discover the endpoints & keys of the issuer (/.well-known/openid-configuration)
+// ctx may carry the *http.Client to use (oidc.ClientContext)
+func New(ctx context.Context, conf Config) (*Provider, error) {
+	provider, err := oidc.NewProvider(ctx, conf.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("cannot discover the OIDC provider %v: %v", conf.Issuer, err)
+	}
+	return &Provider{
+		conf: conf,
+		oauth: oauth2.Config{
+			ClientID:     conf.ClientID,
+			ClientSecret: conf.ClientSecret,
+			RedirectURL:  conf.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: conf.ClientID}),
+	}, nil
+}
+
+// Begin : URL of the authorization request & the flow to be checked by Finish
+func (p *Provider) Begin() (string, *Flow, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	flow := &Flow{State: state, Nonce: nonce, Verifier: oauth2.GenerateVerifier()}
+	url := p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(flow.Verifier))
+	return url, flow, nil
+}
+
+// Finish : exchange the code of the callback & verify the ID token
+func (p *Provider) Finish(ctx context.Context, flow *Flow, state, code string) (*Identity, error) {
+	if flow == nil || state == "" || state != flow.State {
+		return nil, errors.New("state mismatch")
+	}
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("cannot exchange the authorization code: %v", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in the token response")
+	}
+	idToken, err := p.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	id := &Identity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}
+	if !p.allowed(id) {
+		return nil, ErrDomainNotAllowed
+	}
+	return id, nil
+}
+
+// allowed : verified email address in one of [oidc] allowed_domains
+func (p *Provider) allowed(id *Identity) bool {
+	if len(p.conf.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(id.Email, "@")
+	if !id.EmailVerified || at < 0 {
+		return false
+	}
+	domain := strings.ToLower(id.Email[at+1:])
+	for _, d := range p.conf.AllowedDomains {
+		if strings.ToLower(d) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Username : tipstocks username suggested by the claims (preferred_username, the local part of email or the subject)
+// the server appends a suffix if it's already taken
+func (id *Identity) Username() string {
+	candidates := []string{id.PreferredUsername}
+	if at := strings.LastIndex(id.Email, "@"); at > 0 {
+		candidates = append(candidates, id.Email[:at])
+	}
+	candidates = append(candidates, "user-"+id.Subject)
+	for _, c := range candidates {
+		name := strings.Map(func(r rune) rune {
+			if r < 128 && (r == '_' || r == '.' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')) {
+				return r
+			}
+			return -1
+		}, c)
+		if len(name) > 28 { // room for a suffix in 32 characters
+			name = name[:28]
+		}
+		if len(name) >= 3 {
+			return name
+		}
+	}
+	return "user"
+}
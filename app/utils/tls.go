@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"myTips/tipstocks/app/utils/certs"
+	"path/filepath"
+)
+
+// ServerTLSConfig : TLS of the gRPC server ([tls] section)
+// with [tls] client_auth, client certificates signed by [tls] ca are required (mutual TLS)
+func (conf Configs) ServerTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the server certificate: %v", err)
+	}
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.TLSClientAuth {
+		pool, err := loadCA(conf.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.ClientCAs = pool
+		tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConf, nil
+}
+
+// ClientTLSConfig : TLS for dialing the gRPC server ([tls] section)
+// the server certificate is verified with [tls] ca and [tls] server_name (host of the target if blank),
+// and the client certificate is presented with [tls] client_auth
+func (conf Configs) ClientTLSConfig() (*tls.Config, error) {
+	pool, err := loadCA(conf.TLSCA)
+	if err != nil {
+		return nil, err
+	}
+	tlsConf := &tls.Config{
+		RootCAs:    pool,
+		ServerName: conf.TLSServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if conf.TLSClientAuth {
+		cert, err := tls.LoadX509KeyPair(conf.TLSClientCert, conf.TLSClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the client certificate: %v", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
+
+// EnsureCerts : generate the CA, server & client certificates of [tls] unless they exist ([tls] auto = true)
+// the CA key is written next to [tls] ca as ca.key; returns whether the files were generated
+func (conf Configs) EnsureCerts() (bool, error) {
+	files := certs.Files{
+		CACert:     conf.TLSCA,
+		CAKey:      filepath.Join(filepath.Dir(conf.TLSCA), "ca.key"),
+		ServerCert: conf.TLSCert,
+		ServerKey:  conf.TLSKey,
+		ClientCert: conf.TLSClientCert,
+		ClientKey:  conf.TLSClientKey,
+	}
+	opts := certs.DefaultOptions()
+	if len(conf.TLSHosts) > 0 {
+		opts.Hosts = conf.TLSHosts
+	}
+	return certs.Ensure(files, opts)
+}
+
+func loadCA(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load the CA certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %v", path)
+	}
+	return pool, nil
+}
@@ -2,7 +2,17 @@
 
 # generate files
 # ./tools/protoc.sh
-./tools/ssl.sh
+if [ ! -f app/ssl/server.crt ]; then
+    # CA, server & client certificates (regenerate: go run ./app/tipstocks certs init --force)
+    go run ./app/tipstocks certs init --dir app/ssl
+fi
+# secrets read by docker-compose: service token shared by the web client & the gRPC server, key of the session cookies
+touch .env && chmod 600 .env
+for name in TIPSTOCKS_SERVICE_TOKEN TIPSTOCKS_SESSION_SECRET; do
+    if ! grep -q "^${name}=" .env; then
+        echo "${name}=tst_$(head -c 32 /dev/urandom | od -An -tx1 | tr -d ' \n')" >> .env
+    fi
+done
 
 # build client & server apps
 cd app/client
@@ -1,4 +1,9 @@
 #! /bin/bash
+# requires: protoc-gen-go, protoc-gen-go-grpc, protoc-gen-grpc-gateway, protoc-gen-openapiv2
+# google/api/*.proto are vendored in third_party/googleapis
 protoc app/protobuf/tip.proto \
+-I . -I third_party/googleapis \
 --go_out=. --go_opt=paths=source_relative \
 --go-grpc_out=. --go-grpc_opt=paths=source_relative \
+--grpc-gateway_out=. --grpc-gateway_opt=paths=source_relative \
+--openapiv2_out=. \